@@ -0,0 +1,380 @@
+// Package cli 提供命令树、按命令注册的参数和自动生成的帮助信息
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 进程退出码
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// Command 是命令树中的一个节点，有子命令且没有 Run 的节点只用于分组
+type Command struct {
+	Name        string
+	Usage       string // 参数说明，例如 "<email> <password>"
+	Summary     string
+	MinArgs     int
+	MaxArgs     int // 小于 0 表示不限制
+	Flags       func(fs *flag.FlagSet)
+	Run         func(ctx *Context) error
+	Subcommands []*Command
+
+	parent *Command
+}
+
+// Context 是一次命令调用解析后的结果
+type Context struct {
+	Command *Command
+	Args    []string
+	Flags   *flag.FlagSet
+}
+
+// Arg 返回第 i 个位置参数，不存在时返回空字符串
+func (c *Context) Arg(i int) string {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+	return ""
+}
+
+// UsageError 表示命令行参数错误，退出码为 ExitUsage
+type UsageError struct {
+	Command *Command
+	Msg     string
+}
+
+func (e *UsageError) Error() string {
+	return e.Msg
+}
+
+// ExitError 让命令以指定退出码结束，Msg 为空时不输出
+type ExitError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ExitError) Error() string {
+	return e.Msg
+}
+
+// App 是命令行程序的入口
+type App struct {
+	Name        string
+	Summary     string
+	Footer      string
+	GlobalFlags func(fs *flag.FlagSet)
+	Commands    []*Command
+	Stdout      io.Writer
+}
+
+// Run 解析并执行命令，返回进程退出码
+func (a *App) Run(args []string) int {
+	ctx, err := a.Parse(args)
+	if err != nil {
+		return a.handleError(err)
+	}
+	if ctx == nil {
+		return ExitOK
+	}
+	return a.handleError(ctx.Command.Run(ctx))
+}
+
+func (a *App) handleError(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(a.stdout(), "❌ %s\n", usageErr.Msg)
+		if usageErr.Command != nil {
+			a.PrintCommandHelp(usageErr.Command)
+		} else {
+			a.PrintHelp()
+		}
+		return ExitUsage
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.Msg != "" {
+			fmt.Fprintf(a.stdout(), "❌ %s\n", exitErr.Msg)
+		}
+		return exitErr.Code
+	}
+
+	fmt.Fprintf(a.stdout(), "❌ %v\n", err)
+	return ExitFailure
+}
+
+// Parse 找到要执行的命令并解析其参数。请求帮助时输出帮助并返回 nil, nil。
+// 全局参数可以出现在命令之前，例如 "hfile --json status"。
+func (a *App) Parse(args []string) (*Context, error) {
+	a.link()
+
+	var leading []string
+	if len(args) > 0 && args[0] != "-h" && args[0] != "--help" {
+		var err error
+		leading, args, err = a.parseLeadingGlobals(args)
+		if err == flag.ErrHelp {
+			a.PrintHelp()
+			return nil, nil
+		}
+		if err != nil {
+			return nil, &UsageError{Msg: err.Error()}
+		}
+	}
+
+	if len(args) == 0 {
+		return nil, &UsageError{Msg: "missing command"}
+	}
+
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		return nil, a.help(args[1:])
+	}
+
+	cmd := find(a.Commands, args[0])
+	if cmd == nil {
+		return nil, &UsageError{Msg: fmt.Sprintf("unknown command: %s", args[0])}
+	}
+	args = args[1:]
+
+	for len(cmd.Subcommands) > 0 {
+		if len(args) > 0 {
+			if sub := find(cmd.Subcommands, args[0]); sub != nil {
+				cmd = sub
+				args = args[1:]
+				continue
+			}
+		}
+		if cmd.Run != nil {
+			break
+		}
+		if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+			if len(args) == 0 {
+				return nil, &UsageError{Command: cmd, Msg: fmt.Sprintf("missing %s subcommand", cmd.Name)}
+			}
+			a.PrintCommandHelp(cmd)
+			return nil, nil
+		}
+		return nil, &UsageError{Command: cmd, Msg: fmt.Sprintf("invalid %s subcommand: %s", cmd.Name, args[0])}
+	}
+
+	// 命令之前的全局参数放到命令参数的最前面重新解析，命令之后出现的同名参数优先
+	fs := a.flagSet(cmd)
+	positional, err := parseInterspersed(fs, append(leading, args...))
+	if err == flag.ErrHelp {
+		a.PrintCommandHelp(cmd)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &UsageError{Command: cmd, Msg: err.Error()}
+	}
+
+	if len(positional) < cmd.MinArgs {
+		return nil, &UsageError{Command: cmd, Msg: "missing arguments"}
+	}
+	if cmd.MaxArgs >= 0 && len(positional) > cmd.MaxArgs {
+		return nil, &UsageError{Command: cmd, Msg: fmt.Sprintf("unexpected argument: %s", positional[cmd.MaxArgs])}
+	}
+
+	return &Context{Command: cmd, Args: positional, Flags: fs}, nil
+}
+
+// parseLeadingGlobals 解析命令之前的全局参数，返回这些参数本身和剩余的参数
+func (a *App) parseLeadingGlobals(args []string) ([]string, []string, error) {
+	fs := flag.NewFlagSet(a.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if a.GlobalFlags != nil {
+		a.GlobalFlags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	rest := fs.Args()
+	leading := args[:len(args)-len(rest)]
+	// "--" 只用于结束命令之前的参数，不能带到命令参数里
+	if n := len(leading); n > 0 && leading[n-1] == "--" {
+		leading = leading[:n-1]
+	}
+	return append([]string(nil), leading...), rest, nil
+}
+
+// parseInterspersed 允许参数和位置参数交替出现，例如 "push --jobs 8" 与 "login a b --server x"。
+// "--" 之后的内容全部作为位置参数，例如 "check-ignore -- --jobs"。
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func (a *App) flagSet(cmd *Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Path(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	if a.GlobalFlags != nil {
+		a.GlobalFlags(fs)
+	}
+	return fs
+}
+
+func (a *App) help(args []string) error {
+	a.link()
+	if len(args) == 0 {
+		a.PrintHelp()
+		return nil
+	}
+
+	cmds := a.Commands
+	var cmd *Command
+	for _, name := range args {
+		next := find(cmds, name)
+		if next == nil {
+			return &UsageError{Command: cmd, Msg: fmt.Sprintf("unknown command: %s", strings.Join(args, " "))}
+		}
+		cmd = next
+		cmds = cmd.Subcommands
+	}
+	a.PrintCommandHelp(cmd)
+	return nil
+}
+
+// PrintHelp 输出所有命令的概要
+func (a *App) PrintHelp() {
+	out := a.stdout()
+	fmt.Fprintf(out, "%s\n\nUsage:\n", a.Summary)
+	for _, cmd := range a.Commands {
+		printSummaries(out, cmd)
+	}
+	fmt.Fprintf(out, "\nRun '%s help <command>' for details.\n", a.Name)
+	if a.Footer != "" {
+		fmt.Fprintln(out, a.Footer)
+	}
+}
+
+func printSummaries(out io.Writer, cmd *Command) {
+	if cmd.Run != nil {
+		fmt.Fprintf(out, "  %-40s # %s\n", cmd.Path()+" "+cmd.Usage, cmd.Summary)
+	}
+	for _, sub := range cmd.Subcommands {
+		printSummaries(out, sub)
+	}
+}
+
+// PrintCommandHelp 输出单个命令的用法、子命令和参数
+func (a *App) PrintCommandHelp(cmd *Command) {
+	a.link()
+	out := a.stdout()
+
+	fmt.Fprintf(out, "Usage:\n  %s", cmd.Path())
+	if len(cmd.Subcommands) > 0 && cmd.Run == nil {
+		fmt.Fprint(out, " <subcommand>")
+	}
+	if cmd.Run != nil {
+		fmt.Fprint(out, " [flags]")
+	}
+	if cmd.Usage != "" {
+		fmt.Fprintf(out, " %s", cmd.Usage)
+	}
+	fmt.Fprintf(out, "\n\n%s\n", cmd.Summary)
+
+	if len(cmd.Subcommands) > 0 {
+		fmt.Fprintln(out, "\nSubcommands:")
+		for _, sub := range cmd.Subcommands {
+			fmt.Fprintf(out, "  %-16s %s\n", sub.Name, sub.Summary)
+		}
+	}
+
+	if cmd.Run == nil {
+		return
+	}
+
+	if cmd.Flags != nil {
+		fs := flag.NewFlagSet(cmd.Path(), flag.ContinueOnError)
+		cmd.Flags(fs)
+		fmt.Fprintln(out, "\nFlags:")
+		printFlags(out, fs)
+	}
+	if a.GlobalFlags != nil {
+		fs := flag.NewFlagSet(cmd.Path(), flag.ContinueOnError)
+		a.GlobalFlags(fs)
+		fmt.Fprintln(out, "\nGlobal flags:")
+		printFlags(out, fs)
+	}
+}
+
+func printFlags(out io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		line := "--" + f.Name
+		if name != "" {
+			line += " " + name
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(out, "  %-24s %s\n", line, usage)
+	})
+}
+
+// Path 返回从程序名开始的完整命令，例如 "hfile config list"
+func (c *Command) Path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.Path() + " " + c.Name
+}
+
+// link 设置每个命令的父节点，根命令的父节点是代表程序本身的伪命令
+func (a *App) link() {
+	root := &Command{Name: a.Name}
+	for _, cmd := range a.Commands {
+		linkCommand(cmd, root)
+	}
+}
+
+func linkCommand(cmd, parent *Command) {
+	cmd.parent = parent
+	for _, sub := range cmd.Subcommands {
+		linkCommand(sub, cmd)
+	}
+}
+
+func find(cmds []*Command, name string) *Command {
+	for _, cmd := range cmds {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func (a *App) stdout() io.Writer {
+	if a.Stdout != nil {
+		return a.Stdout
+	}
+	return os.Stdout
+}
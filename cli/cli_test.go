@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testOptions 收集测试命令解析出的参数
+type testOptions struct {
+	json    bool
+	repoDir string
+	jobs    int
+	all     bool
+}
+
+func newTestApp(opts *testOptions) *App {
+	run := func(ctx *Context) error { return nil }
+	return &App{
+		Name:    "hfile",
+		Summary: "hfile test",
+		Stdout:  io.Discard,
+		GlobalFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&opts.json, "json", false, "json output")
+			fs.StringVar(&opts.repoDir, "repo-dir", ".", "repository `dir`")
+		},
+		Commands: []*Command{
+			{
+				Name:    "push",
+				Summary: "push",
+				Flags:   func(fs *flag.FlagSet) { fs.IntVar(&opts.jobs, "jobs", 0, "jobs") },
+				Run:     run,
+			},
+			{
+				Name:    "login",
+				Usage:   "<email> <password>",
+				Summary: "login",
+				MinArgs: 2,
+				MaxArgs: 2,
+				Run:     run,
+			},
+			{
+				Name:    "logout",
+				Summary: "logout",
+				MaxArgs: -1,
+				Flags:   func(fs *flag.FlagSet) { fs.BoolVar(&opts.all, "all", false, "all") },
+				Run:     run,
+			},
+			{
+				Name:    "config",
+				Summary: "config",
+				Subcommands: []*Command{
+					{Name: "get", Usage: "<key>", Summary: "get", MinArgs: 1, MaxArgs: 1, Run: run},
+					{Name: "list", Summary: "list", Run: run},
+				},
+			},
+		},
+	}
+}
+
+func TestAppParse(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+
+		// 期望的解析结果，command 为空表示期望 nil, nil（输出了帮助）
+		command string
+		posArgs []string
+		opts    testOptions
+
+		// 期望的 UsageError 信息，为空表示期望解析成功
+		usageErr string
+	}{
+		{name: "no arguments", args: nil, usageErr: "missing command"},
+		{name: "unknown command", args: []string{"nope"}, usageErr: "unknown command: nope"},
+		{name: "help", args: []string{"help"}},
+		{name: "help for a command", args: []string{"help", "push"}},
+		{name: "help flag", args: []string{"--help", "push"}},
+		{name: "help for an unknown command", args: []string{"help", "nope"}, usageErr: "unknown command: nope"},
+		{name: "command help flag", args: []string{"push", "-h"}},
+		{
+			name:    "command without flags",
+			args:    []string{"push"},
+			command: "hfile push",
+			opts:    testOptions{repoDir: "."},
+		},
+		{
+			name:    "command flag",
+			args:    []string{"push", "--jobs", "8"},
+			command: "hfile push",
+			opts:    testOptions{repoDir: ".", jobs: 8},
+		},
+		{
+			name:    "flags between positional arguments",
+			args:    []string{"login", "a@b.c", "--repo-dir", "work", "secret"},
+			command: "hfile login",
+			posArgs: []string{"a@b.c", "secret"},
+			opts:    testOptions{repoDir: "work"},
+		},
+		{
+			name:    "global flag after command",
+			args:    []string{"push", "--json"},
+			command: "hfile push",
+			opts:    testOptions{json: true, repoDir: "."},
+		},
+		{
+			name:    "global flag before command",
+			args:    []string{"--json", "push"},
+			command: "hfile push",
+			opts:    testOptions{json: true, repoDir: "."},
+		},
+		{
+			name:    "global flags on both sides",
+			args:    []string{"--repo-dir", "work", "push", "--json", "--jobs", "2"},
+			command: "hfile push",
+			opts:    testOptions{json: true, repoDir: "work", jobs: 2},
+		},
+		{
+			name:    "global flag after command wins",
+			args:    []string{"--repo-dir", "a", "push", "--repo-dir", "b"},
+			command: "hfile push",
+			opts:    testOptions{repoDir: "b"},
+		},
+		{
+			name: "global flag before help",
+			args: []string{"--json", "help", "push"},
+		},
+		{
+			name:    "double dash ends leading flags",
+			args:    []string{"--json", "--", "logout", "--all"},
+			command: "hfile logout",
+			opts:    testOptions{json: true, repoDir: ".", all: true},
+		},
+		{
+			name:    "double dash ends command flags",
+			args:    []string{"logout", "--", "--all"},
+			command: "hfile logout",
+			posArgs: []string{"--all"},
+			opts:    testOptions{repoDir: "."},
+		},
+		{
+			name:    "flags after double dash are positional",
+			args:    []string{"login", "--", "--json", "--repo-dir"},
+			command: "hfile login",
+			posArgs: []string{"--json", "--repo-dir"},
+			opts:    testOptions{repoDir: "."},
+		},
+		{
+			name:    "double dash after positional arguments",
+			args:    []string{"logout", "a", "--", "--all", "b"},
+			command: "hfile logout",
+			posArgs: []string{"a", "--all", "b"},
+			opts:    testOptions{repoDir: "."},
+		},
+		{name: "command flag before command", args: []string{"--jobs", "8", "push"}, usageErr: "flag provided but not defined: -jobs"},
+		{name: "unknown flag before command", args: []string{"--bogus", "push"}, usageErr: "flag provided but not defined: -bogus"},
+		{name: "unknown flag after command", args: []string{"push", "--bogus"}, usageErr: "flag provided but not defined: -bogus"},
+		{name: "global flag without command", args: []string{"--json"}, usageErr: "missing command"},
+		{
+			name:    "subcommand",
+			args:    []string{"config", "get", "server"},
+			command: "hfile config get",
+			posArgs: []string{"server"},
+			opts:    testOptions{repoDir: "."},
+		},
+		{
+			name:    "global flag before subcommand",
+			args:    []string{"--json", "config", "list"},
+			command: "hfile config list",
+			opts:    testOptions{json: true, repoDir: "."},
+		},
+		{name: "missing subcommand", args: []string{"config"}, usageErr: "missing config subcommand"},
+		{name: "invalid subcommand", args: []string{"config", "nope"}, usageErr: "invalid config subcommand: nope"},
+		{name: "subcommand help", args: []string{"config", "--help"}},
+		{name: "missing arguments", args: []string{"login", "a@b.c"}, usageErr: "missing arguments"},
+		{name: "too many arguments", args: []string{"login", "a", "b", "c"}, usageErr: "unexpected argument: c"},
+		{name: "invalid flag value", args: []string{"push", "--jobs", "x"}, usageErr: `invalid value "x" for flag -jobs: parse error`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts testOptions
+			ctx, err := newTestApp(&opts).Parse(tt.args)
+
+			if tt.usageErr != "" {
+				var usageErr *UsageError
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("Parse(%q) error = %v, want UsageError %q", tt.args, err, tt.usageErr)
+				}
+				if usageErr.Msg != tt.usageErr {
+					t.Fatalf("Parse(%q) error = %q, want %q", tt.args, usageErr.Msg, tt.usageErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.args, err)
+			}
+
+			if tt.command == "" {
+				if ctx != nil {
+					t.Fatalf("Parse(%q) = %s, want help only", tt.args, ctx.Command.Path())
+				}
+				return
+			}
+			if ctx == nil {
+				t.Fatalf("Parse(%q) returned no command, want %s", tt.args, tt.command)
+			}
+			if got := ctx.Command.Path(); got != tt.command {
+				t.Errorf("command = %q, want %q", got, tt.command)
+			}
+			if len(ctx.Args) != 0 || len(tt.posArgs) != 0 {
+				if !reflect.DeepEqual(ctx.Args, tt.posArgs) {
+					t.Errorf("args = %q, want %q", ctx.Args, tt.posArgs)
+				}
+			}
+			if opts != tt.opts {
+				t.Errorf("options = %+v, want %+v", opts, tt.opts)
+			}
+		})
+	}
+}
+
+func TestAppRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		err     error
+		code    int
+		wantOut string
+	}{
+		{name: "success", args: []string{"push"}, code: ExitOK},
+		{name: "help", args: []string{"help"}, code: ExitOK},
+		{name: "usage error", args: []string{"--json", "nope"}, code: ExitUsage, wantOut: "❌ unknown command: nope"},
+		{name: "command error", args: []string{"push"}, err: errors.New("boom"), code: ExitFailure, wantOut: "❌ boom"},
+		{name: "exit error", args: []string{"push"}, err: &ExitError{Code: 130}, code: 130},
+		{name: "exit error with message", args: []string{"push"}, err: &ExitError{Code: 3, Msg: "stopped"}, code: 3, wantOut: "❌ stopped"},
+		{
+			name: "usage error from command",
+			args: []string{"push"},
+			err:  &UsageError{Msg: "--jobs must be a positive integer"},
+			code: ExitUsage, wantOut: "❌ --jobs must be a positive integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts testOptions
+			var out strings.Builder
+			app := newTestApp(&opts)
+			app.Stdout = &out
+			app.Commands[0].Run = func(ctx *Context) error { return tt.err }
+
+			if code := app.Run(tt.args); code != tt.code {
+				t.Errorf("Run(%q) = %d, want %d", tt.args, code, tt.code)
+			}
+			if tt.wantOut != "" && !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.wantOut)
+			}
+			if tt.wantOut == "" && strings.Contains(out.String(), "❌") {
+				t.Errorf("unexpected error output %q", out.String())
+			}
+		})
+	}
+}
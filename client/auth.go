@@ -0,0 +1,231 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/litongjava/hfile/model"
+)
+
+const (
+	RegisterPath   = "/api/v1/register"
+	LoginPath      = "/api/v1/login"
+	RefreshPath    = "/api/v1/refresh"
+	LogoutPath     = "/api/v1/logout"
+	ProfilePath    = "/api/v1/user/profile"
+	RepoListPath   = "/repo/list"
+	RepoRenamePath = "/repo/rename"
+)
+
+// maxPeekSize 只检查较小的 JSON 响应体中是否包含 token 过期的错误码
+const maxPeekSize = 64 * 1024
+
+var (
+	// ErrLogoutUnsupported 表示服务器没有提供注销接口
+	ErrLogoutUnsupported = errors.New("server does not support token revocation")
+	// ErrNoRefresh 表示 token 来源不支持刷新
+	ErrNoRefresh = errors.New("token can not be refreshed")
+)
+
+// Tokens 是登录或刷新得到的一对令牌
+type Tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Profile 是当前用户的信息，不同服务器返回的字段不同，Raw 保留全部字段
+type Profile struct {
+	ID       string
+	Username string
+	Email    string
+	Name     string
+	Raw      map[string]interface{}
+}
+
+// UnmarshalJSON 接受任意 JSON 对象，id 可以是字符串或数字
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	str := func(key string) string {
+		if v, ok := raw[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	*p = Profile{ID: str("id"), Username: str("username"), Email: str("email"), Name: str("name"), Raw: raw}
+	return nil
+}
+
+// MarshalJSON 输出服务器返回的原始字段
+func (p Profile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Raw)
+}
+
+// DisplayName 返回用于显示的账号名：username > email > name > id
+func (p Profile) DisplayName() string {
+	for _, name := range []string{p.Username, p.Email, p.Name, p.ID} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// TokenSource 为请求提供 access token。服务器返回 token 过期时，Client 调用 Refresh
+// 换取新 token 并重发请求；多个请求同时过期时 Refresh 应只刷新一次。
+type TokenSource interface {
+	Token() string
+	Refresh(ctx context.Context, c *Client, expired string) (string, error)
+}
+
+// StaticToken 是固定不变的 token，不支持刷新
+type StaticToken string
+
+func (t StaticToken) Token() string {
+	return string(t)
+}
+
+func (t StaticToken) Refresh(ctx context.Context, c *Client, expired string) (string, error) {
+	return "", ErrNoRefresh
+}
+
+// tokenExpired 判断响应是否表示 token 失效：HTTP 401，或 JSON 响应中 code 为 401
+func tokenExpired(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") ||
+		resp.ContentLength < 0 || resp.ContentLength > maxPeekSize {
+		return false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var apiResp model.APIResponse
+	if json.Unmarshal(body, &apiResp) != nil {
+		return false
+	}
+	return !apiResp.Ok && apiResp.Code == http.StatusUnauthorized
+}
+
+// Register 注册用户，用户名已存在等校验错误在 *APIError 的 Fields 中
+func (c *Client) Register(ctx context.Context, username, password string) error {
+	req, err := c.newJSONRequest(ctx, "POST", RegisterPath, nil, model.RegisterRequest{
+		Username:         username,
+		Password:         password,
+		UserType:         1,
+		VerificationType: 0, // 不验证邮箱
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, nil)
+}
+
+// Login 登录并返回令牌，令牌由调用方保存
+func (c *Client) Login(ctx context.Context, username, password string) (Tokens, error) {
+	var tokens Tokens
+	req, err := c.newJSONRequest(ctx, "POST", LoginPath, nil, model.LoginRequest{Username: username, Password: password})
+	if err != nil {
+		return tokens, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+	if err := decodeResponse(resp, &tokens); err != nil {
+		return tokens, err
+	}
+	if tokens.Token == "" {
+		return tokens, fmt.Errorf("token not found in login response")
+	}
+	return tokens, nil
+}
+
+// Refresh 用 refresh token 换取新的令牌，服务器不轮换 refresh token 时返回的 RefreshToken 为空
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	var tokens Tokens
+	req, err := c.newJSONRequest(ctx, "POST", RefreshPath, nil, model.RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return tokens, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+	if err := decodeResponse(resp, &tokens); err != nil {
+		return tokens, fmt.Errorf("refresh failed: %w", err)
+	}
+	if tokens.Token == "" {
+		return tokens, fmt.Errorf("token not found in refresh response")
+	}
+	return tokens, nil
+}
+
+// Logout 在服务器端注销当前 token 及 refreshToken，服务器不支持注销时返回 ErrLogoutUnsupported。
+// token 已经失效时视为成功。
+func (c *Client) Logout(ctx context.Context, refreshToken string) error {
+	req, err := c.newJSONRequest(ctx, "POST", LogoutPath, nil, model.RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+	if c.Tokens != nil {
+		req.Header.Set("Authorization", "Bearer "+c.Tokens.Token())
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// 没有 JSON 响应的 404/405 说明接口不存在，JSON 错误响应按普通错误返回
+	if isUnsupported(resp.StatusCode, body) {
+		return ErrLogoutUnsupported
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := decodeResponse(resp, nil); err != nil {
+		return fmt.Errorf("logout failed: %w", err)
+	}
+	return nil
+}
+
+// Profile 返回当前用户信息
+func (c *Client) Profile(ctx context.Context) (Profile, error) {
+	var profile Profile
+	err := c.withRetry(ctx, "fetch profile", func() error {
+		req, err := c.newRequest(ctx, "GET", ProfilePath, nil, nil)
+		if err != nil {
+			return err
+		}
+		return c.doJSON(req, &profile)
+	})
+	return profile, err
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+
+		wantErr     bool
+		unsupported bool
+		apiCode     int
+	}{
+		{name: "ok", status: http.StatusOK, body: `{"ok":true,"code":200}`},
+		{name: "token already expired", status: http.StatusUnauthorized, body: `{"ok":false,"code":401,"msg":"unauthorized"}`},
+		{name: "plain 404", status: http.StatusNotFound, body: "404 page not found", wantErr: true, unsupported: true},
+		{name: "plain 405", status: http.StatusMethodNotAllowed, wantErr: true, unsupported: true},
+		{
+			// 路由存在但服务器返回了 JSON 错误，不能当作不支持注销
+			name: "404 with an error envelope", status: http.StatusNotFound,
+			body:    `{"ok":false,"code":404,"msg":"refresh token not found"}`,
+			wantErr: true, apiCode: 404,
+		},
+		{
+			name: "server error", status: http.StatusInternalServerError,
+			body:    `{"ok":false,"code":500,"msg":"boom"}`,
+			wantErr: true, apiCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != LogoutPath {
+					t.Errorf("request to %s, want %s", r.URL.Path, LogoutPath)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, StaticToken("token"))
+			c.Retry = RetryPolicy{MaxAttempts: 1}
+			err := c.Logout(context.Background(), "refresh")
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Logout succeeded, want an error")
+			}
+			if got := errors.Is(err, ErrLogoutUnsupported); got != tt.unsupported {
+				t.Errorf("Logout error = %v, unsupported = %v, want %v", err, got, tt.unsupported)
+			}
+			var apiErr *APIError
+			if tt.apiCode != 0 && (!errors.As(err, &apiErr) || apiErr.Code != tt.apiCode) {
+				t.Errorf("Logout error = %v, want an API error with code %d", err, tt.apiCode)
+			}
+		})
+	}
+}
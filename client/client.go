@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// DefaultUserAgent 是未设置 Client.UserAgent 时发送的 User-Agent
+const DefaultUserAgent = "hfile-client"
+
+// Client 访问一个 hfile 服务器。方法不输出任何内容，结果和错误由调用方处理；
+// 服务器返回的错误为 *APIError。Client 可以被多个 goroutine 同时使用。
+//
+//	c := client.New("https://hfile.example.com", client.StaticToken(token))
+//	files, err := c.Files(ctx, "demo")
+type Client struct {
+	// BaseURL 是服务器地址，例如 https://hfile.example.com
+	BaseURL string
+	// Tokens 为需要登录的请求提供 token，为 nil 时不发送 Authorization
+	Tokens TokenSource
+	// HTTPClient 为 nil 时使用 http.DefaultClient
+	HTTPClient *http.Client
+	// UserAgent 为空时使用 DefaultUserAgent
+	UserAgent string
+	// Logger 记录传输进度，为 nil 时使用 hlog 的默认 logger
+	Logger hlog.FullLogger
+	// Chunks 控制大文件的分片上传，零值字段使用默认值
+	Chunks ChunkOptions
+	// Retry 控制临时错误的重试，New 设置为 DefaultRetryPolicy()，零值表示不重试
+	Retry RetryPolicy
+	// OnRetry 在每次重试等待之前调用，ctx 是发起操作时传入的 ctx，可能被多个 goroutine 同时调用；
+	// 为 nil 时重试记录到 Logger 的 debug 日志
+	OnRetry func(ctx context.Context, event RetryEvent)
+}
+
+// New 创建访问 baseURL 的客户端
+func New(baseURL string, tokens TokenSource) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Tokens:  tokens,
+		Retry:   DefaultRetryPolicy(),
+	}
+}
+
+// FieldError 是表单校验失败时某个字段的错误
+type FieldError struct {
+	Field    string   `json:"field"`
+	Messages []string `json:"messages"`
+}
+
+// APIError 是服务器返回的错误：HTTP 状态码不是 200，或 APIResponse 中 ok 为 false
+type APIError struct {
+	// StatusCode 是 HTTP 状态码
+	StatusCode int
+	// Code 和 Msg 来自 APIResponse，响应不是 APIResponse 时为零值
+	Code int
+	Msg  string
+	// Fields 是表单校验错误，例如注册时用户名已存在
+	Fields []FieldError
+	// Body 是响应不是 APIResponse 时的原始内容
+	Body string
+	// RetryAfter 是响应头 Retry-After 要求的等待时间，没有时为 0
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = strings.TrimSpace(e.Body)
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (status %d)", msg, e.StatusCode)
+	for _, field := range e.Fields {
+		fmt.Fprintf(&b, "; %s: %s", field.Field, strings.Join(field.Messages, ", "))
+	}
+	return b.String()
+}
+
+// envelope 是 APIResponse，data 保留原始 JSON 以便解码为具体类型
+type envelope struct {
+	Code  int             `json:"code"`
+	Msg   *string         `json:"msg"`
+	Ok    bool            `json:"ok"`
+	Error *string         `json:"error"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) logger() hlog.FullLogger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return hlog.DefaultLogger()
+}
+
+// newRequest 创建发往 BaseURL+path 的请求，query 为 nil 时不带查询参数
+func (c *Client) newRequest(ctx context.Context, method, path string, query neturl.Values, body io.Reader) (*http.Request, error) {
+	url := c.BaseURL + path
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent())
+	return req, nil
+}
+
+// newJSONRequest 创建请求体为 JSON 的请求
+func (c *Client) newJSONRequest(ctx context.Context, method, path string, query neturl.Values, v interface{}) (*http.Request, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, method, path, query, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (c *Client) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// do 带上 Bearer token 发送请求。服务器返回 token 过期时，
+// 通过 Tokens 换取新 token 并重发一次；请求体无法重放时直接返回原响应。
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Tokens == nil {
+		return c.httpClient().Do(req)
+	}
+	token := c.Tokens.Token()
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil || !tokenExpired(resp) {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, refreshErr := c.Tokens.Refresh(req.Context(), c, token)
+	if refreshErr != nil {
+		c.logger().Debugf("Token refresh failed: %v", refreshErr)
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+newToken)
+	return c.httpClient().Do(retry)
+}
+
+// doJSON 发送请求并把 APIResponse 的 data 解码到 out，out 为 nil 时忽略 data。
+// HTTP 状态码不是 200 或 ok 为 false 时返回 *APIError。
+func (c *Client) doJSON(req *http.Request, out interface{}) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse 读取并解码 APIResponse
+func decodeResponse(resp *http.Response, out interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{StatusCode: resp.StatusCode, Body: string(body), RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		// 不需要 data 时接受非 JSON 的成功响应
+		if out == nil {
+			return nil
+		}
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !env.Ok {
+		apiErr := newAPIError(resp.StatusCode, env)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return apiErr
+	}
+	if out == nil || len(env.Data) == 0 || string(env.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("invalid response data: %v", err)
+	}
+	return nil
+}
+
+func newAPIError(status int, env envelope) *APIError {
+	apiErr := &APIError{StatusCode: status, Code: env.Code}
+	if env.Msg != nil && *env.Msg != "" {
+		apiErr.Msg = *env.Msg
+	} else if env.Error != nil {
+		apiErr.Msg = *env.Error
+	}
+	// 表单校验失败时 data 为 [{field, messages}]
+	var fields []FieldError
+	if json.Unmarshal(env.Data, &fields) == nil {
+		for _, field := range fields {
+			if field.Field != "" {
+				apiErr.Fields = append(apiErr.Fields, field)
+			}
+		}
+	}
+	return apiErr
+}
+
+// isUnsupported 判断响应是否表示接口不存在：404/405 且响应体不是 APIResponse
+func isUnsupported(status int, body []byte) bool {
+	if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		return false
+	}
+	var env envelope
+	return json.Unmarshal(body, &env) != nil
+}
+
+// repoQuery 返回只包含 repo 的查询参数
+func repoQuery(repo string) neturl.Values {
+	return neturl.Values{"repo": {repo}}
+}
@@ -0,0 +1,105 @@
+package clienttest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FaultKind 是注入的故障类型
+type FaultKind int
+
+const (
+	// FaultStatus 不处理请求，直接返回 Fault.Status（默认 500）和错误信封
+	FaultStatus FaultKind = iota
+	// FaultDropConnection 读取请求后直接关闭连接，不返回任何响应
+	FaultDropConnection
+	// FaultTruncateBody 下载时只发送一半内容就结束响应，只对 /file/download 有效
+	FaultTruncateBody
+	// FaultMalformedModTime 文件列表中的 mod_time 不是数字，只对 /file/list 有效
+	FaultMalformedModTime
+)
+
+// Fault 描述一次故障注入
+type Fault struct {
+	// Path 是匹配的请求路径，例如 "/file/upload/chunk"，为空时匹配所有请求
+	Path string
+	Kind FaultKind
+	// Status 是 FaultStatus 返回的状态码，为 0 时使用 500
+	Status int
+	// RetryAfter 是 FaultStatus 响应头 Retry-After 的秒数，为 0 时不发送
+	RetryAfter time.Duration
+	// Times 是故障生效的次数，为 0 时一直生效直到 ClearFaults
+	Times int
+}
+
+// Inject 添加一个故障，多个故障按添加顺序匹配
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults 移除所有故障
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// takeFault 查找匹配 r 的 kind 类型故障并消耗一次
+func (s *Server) takeFault(r *http.Request, kind FaultKind) bool {
+	_, ok := s.matchFault(r, kind)
+	return ok
+}
+
+// matchFault 查找匹配 r 的 kind 类型故障并消耗一次，返回该故障的副本
+func (s *Server) matchFault(r *http.Request, kind FaultKind) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if f.Kind != kind || (f.Path != "" && f.Path != r.URL.Path) {
+			continue
+		}
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return matched, true
+	}
+	return Fault{}, false
+}
+
+// withFaults 记录请求，并在交给 next 之前处理状态码和断开连接类的故障
+func (s *Server) withFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+
+		if _, ok := s.matchFault(r, FaultDropConnection); ok {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if f, ok := s.matchFault(r, FaultStatus); ok {
+			status := f.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			if f.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+			}
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
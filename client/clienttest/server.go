@@ -0,0 +1,524 @@
+// Package clienttest 提供进程内的 hfile 假服务器，基于 httptest，用于在不依赖真实服务器的情况下
+// 驱动 client 包的上传、分片上传、断点下载、登录和错误处理，并可按接口注入故障。
+//
+//	srv := clienttest.NewServer()
+//	defer srv.Close()
+//	srv.PutFile("demo", "a.txt", []byte("hello"), time.Now().Unix())
+//	srv.Inject(clienttest.Fault{Path: "/file/download", Kind: clienttest.FaultTruncateBody, Times: 1})
+//	files, err := client.New(srv.URL, client.StaticToken(srv.Token())).Files(ctx, "demo")
+package clienttest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/litongjava/hfile/model"
+)
+
+const (
+	// Username 和 Password 是假服务器唯一接受的账号
+	Username = "tester"
+	Password = "secret123"
+)
+
+// File 是假服务器中的一个文件
+type File struct {
+	Content []byte
+	ModTime int64
+}
+
+// Hash 返回文件内容的 SHA-256（十六进制）
+func (f File) Hash() string {
+	sum := sha256.Sum256(f.Content)
+	return hex.EncodeToString(sum[:])
+}
+
+type chunkUpload struct {
+	repo     string
+	fileName string
+	size     int64
+	total    int
+	modTime  int64
+	hash     string
+	parts    map[int][]byte
+}
+
+// Server 是进程内的 hfile 假服务器，所有方法都可以并发调用
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	tokenSeq     int
+	repos        map[string]map[string]File
+	uploads      map[string]*chunkUpload
+	uploadSeq    int
+	faults       []*Fault
+	requests     []string
+}
+
+// NewServer 启动假服务器，调用方负责 Close
+func NewServer() *Server {
+	s := &Server{
+		repos:   map[string]map[string]File{},
+		uploads: map[string]*chunkUpload{},
+	}
+	s.rotateTokens()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/login", s.handleLogin)
+	mux.HandleFunc("POST /api/v1/refresh", s.handleRefresh)
+	mux.HandleFunc("POST /api/v1/logout", s.handleLogout)
+	mux.HandleFunc("GET /api/v1/user/profile", s.auth(s.handleProfile))
+	mux.HandleFunc("GET /repo/list", s.auth(s.handleRepoList))
+	mux.HandleFunc("GET /file/list", s.auth(s.handleFileList))
+	mux.HandleFunc("POST /file/upload", s.auth(s.handleUpload))
+	mux.HandleFunc("POST /file/delete", s.auth(s.handleDelete))
+	mux.HandleFunc("GET /file/download", s.auth(s.handleDownload))
+	mux.HandleFunc("POST /file/upload/init", s.auth(s.handleUploadInit))
+	mux.HandleFunc("POST /file/upload/chunk", s.auth(s.handleUploadChunk))
+	mux.HandleFunc("GET /file/upload/status", s.auth(s.handleUploadStatus))
+	mux.HandleFunc("POST /file/upload/complete", s.auth(s.handleUploadComplete))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+
+	s.Server = httptest.NewServer(s.withFaults(mux))
+	return s
+}
+
+// Token 返回当前有效的 access token
+func (s *Server) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// RefreshToken 返回当前有效的 refresh token
+func (s *Server) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshToken
+}
+
+// ExpireToken 使当前 access token 失效，下一个请求会收到 401，refresh token 仍然有效
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = fmt.Sprintf("expired-%d", s.tokenSeq)
+}
+
+// PutFile 直接在仓库中放入文件，不经过上传接口
+func (s *Server) PutFile(repo, path string, content []byte, modTime int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repo(repo)[path] = File{Content: append([]byte(nil), content...), ModTime: modTime}
+}
+
+// RemoveFile 直接删除仓库中的文件
+func (s *Server) RemoveFile(repo, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.repos[repo], path)
+}
+
+// File 返回仓库中的文件
+func (s *Server) File(repo, path string) (File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.repos[repo][path]
+	return f, ok
+}
+
+// Files 返回仓库中所有文件的副本
+func (s *Server) Files(repo string) map[string]File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]File, len(s.repos[repo]))
+	for path, f := range s.repos[repo] {
+		files[path] = f
+	}
+	return files
+}
+
+// PendingUploads 返回尚未完成的分片上传数
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// Requests 返回收到的请求，格式为 "METHOD /path"，按到达顺序
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// CountRequests 返回 "METHOD /path" 为 request 的请求数
+func (s *Server) CountRequests(request string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// repo 返回仓库的文件表，不存在时创建，调用方需持有 mu
+func (s *Server) repo(name string) map[string]File {
+	files := s.repos[name]
+	if files == nil {
+		files = map[string]File{}
+		s.repos[name] = files
+	}
+	return files
+}
+
+// rotateTokens 生成新的一对令牌，调用方需持有 mu（NewServer 中除外）
+func (s *Server) rotateTokens() {
+	s.tokenSeq++
+	s.token = fmt.Sprintf("token-%d", s.tokenSeq)
+	s.refreshToken = fmt.Sprintf("refresh-%d", s.tokenSeq)
+}
+
+// auth 校验 Bearer token，失败时返回 401 和错误信封
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		token := s.token
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "token expired")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req model.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Username != Username || req.Password != Password {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+	s.mu.Lock()
+	s.rotateTokens()
+	data := map[string]string{"token": s.token, "refresh_token": s.refreshToken}
+	s.mu.Unlock()
+	writeData(w, data)
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req model.RefreshRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.RefreshToken != s.refreshToken {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	s.rotateTokens()
+	writeData(w, map[string]string{"token": s.token, "refresh_token": s.refreshToken})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.token = fmt.Sprintf("revoked-%d", s.tokenSeq)
+	s.refreshToken = ""
+	s.mu.Unlock()
+	writeData(w, nil)
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	writeData(w, map[string]string{"username": Username})
+}
+
+func (s *Server) handleRepoList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	repos := make([]string, 0, len(s.repos))
+	for name := range s.repos {
+		repos = append(repos, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(repos)
+	writeData(w, repos)
+}
+
+// handleFileList 与真实服务器一样以字符串返回 mod_time
+func (s *Server) handleFileList(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	malformed := s.takeFault(r, FaultMalformedModTime)
+
+	entries := []map[string]interface{}{}
+	for path, f := range s.Files(repo) {
+		modTime := strconv.FormatInt(f.ModTime, 10)
+		if malformed {
+			modTime = "not-a-number"
+		}
+		entries = append(entries, map[string]interface{}{
+			"path":     path,
+			"hash":     f.Hash(),
+			"mod_time": modTime,
+			"size":     len(f.Content),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i]["path"].(string) < entries[j]["path"].(string) })
+	writeData(w, entries)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+	fileName, content, fields, err := readMultipart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f := File{Content: content, ModTime: parseModTime(fields["original_mod_time"])}
+	if want := fields["hash"]; want != "" && want != f.Hash() {
+		writeError(w, http.StatusBadRequest, "hash mismatch")
+		return
+	}
+
+	s.mu.Lock()
+	s.repo(repo)[fileName] = f
+	s.mu.Unlock()
+	writeData(w, nil)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	s.RemoveFile(r.URL.Query().Get("repo"), r.URL.Query().Get("file"))
+	writeData(w, nil)
+}
+
+// handleDownload 支持 Range: bytes=N- 和 If-Range，返回 ETag、Last-Modified 和 X-Content-SHA256
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.File(r.URL.Query().Get("repo"), r.URL.Query().Get("file"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	etag := `"` + f.Hash() + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-SHA256", f.Hash())
+	w.Header().Set("Last-Modified", time.Unix(f.ModTime, 0).UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	content := f.Content
+	status := http.StatusOK
+	rangeHeader := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+	if spec, ok := strings.CutPrefix(rangeHeader, "bytes="); ok {
+		start, err := strconv.Atoi(strings.TrimSuffix(spec, "-"))
+		if err != nil || !strings.HasSuffix(spec, "-") || start >= len(content) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "requested range not satisfiable")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		content = content[start:]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(status)
+	if s.takeFault(r, FaultTruncateBody) {
+		// 只写一半内容后返回，客户端读到的内容比 Content-Length 短
+		w.Write(content[:len(content)/2])
+		return
+	}
+	w.Write(content)
+}
+
+func (s *Server) handleUploadInit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Repo       string `json:"repo"`
+		FileName   string `json:"file_name"`
+		FileSize   int64  `json:"file_size"`
+		TotalParts int    `json:"total_parts"`
+		ModTime    int64  `json:"original_mod_time"`
+		Hash       string `json:"hash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TotalParts <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	s.uploadSeq++
+	id := fmt.Sprintf("upload-%d", s.uploadSeq)
+	s.uploads[id] = &chunkUpload{
+		repo: req.Repo, fileName: req.FileName, size: req.FileSize, total: req.TotalParts,
+		modTime: req.ModTime, hash: req.Hash, parts: map[int][]byte{},
+	}
+	s.mu.Unlock()
+	writeData(w, map[string]string{"upload_id": id})
+}
+
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	_, content, fields, err := readMultipart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := fields["upload_id"]
+	index, err := strconv.Atoi(fields["part_index"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid part_index")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusGone, "upload not found")
+		return
+	}
+	if index < 0 || index >= upload.total {
+		writeError(w, http.StatusBadRequest, "part_index out of range")
+		return
+	}
+	upload.parts[index] = content
+	writeData(w, model.ChunkUploadResponse{PartIndex: index, UploadID: id, ETag: partETag(content)})
+}
+
+func (s *Server) handleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[r.URL.Query().Get("upload_id")]
+	if !ok {
+		writeError(w, http.StatusGone, "upload not found")
+		return
+	}
+	parts := []model.CompletedPart{}
+	for index, content := range upload.parts {
+		parts = append(parts, model.CompletedPart{PartIndex: index, ETag: partETag(content)})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartIndex < parts[j].PartIndex })
+	writeData(w, map[string]interface{}{"parts": parts})
+}
+
+func (s *Server) handleUploadComplete(w http.ResponseWriter, r *http.Request) {
+	var req model.CompleteUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[req.UploadID]
+	if !ok {
+		writeError(w, http.StatusGone, "upload not found")
+		return
+	}
+	if len(req.Parts) != upload.total {
+		writeError(w, http.StatusBadRequest, "missing parts")
+		return
+	}
+
+	var content []byte
+	for i := 0; i < upload.total; i++ {
+		part, ok := upload.parts[i]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("part %d has not been uploaded", i))
+			return
+		}
+		content = append(content, part...)
+	}
+	f := File{Content: content, ModTime: upload.modTime}
+	if int64(len(content)) != upload.size || (upload.hash != "" && upload.hash != f.Hash()) {
+		writeError(w, http.StatusBadRequest, "size or hash mismatch")
+		return
+	}
+	s.repo(upload.repo)[upload.fileName] = f
+	delete(s.uploads, req.UploadID)
+	writeData(w, nil)
+}
+
+// readMultipart 读取 multipart 请求体，返回文件名（未经 Base 处理的完整路径）、文件内容和其余字段
+func readMultipart(r *http.Request) (string, []byte, map[string]string, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return "", nil, nil, fmt.Errorf("expected multipart/form-data request")
+	}
+
+	var fileName string
+	var content []byte
+	fields := map[string]string{}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if part.FormName() == "file" {
+			_, disposition, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			fileName, content = disposition["filename"], data
+			continue
+		}
+		fields[part.FormName()] = string(data)
+	}
+	if fileName == "" {
+		return "", nil, nil, fmt.Errorf("missing file part")
+	}
+	return fileName, content, fields, nil
+}
+
+func partETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+func parseModTime(value string) int64 {
+	if t, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return t
+	}
+	return time.Now().Unix()
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, http.StatusOK, model.APIResponse{Code: http.StatusOK, Ok: true, Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, model.APIResponse{Code: status, Ok: false, Msg: &msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp model.APIResponse) {
+	body, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
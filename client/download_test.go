@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/client/clienttest"
+)
+
+func TestDownloadRestartsAfterStalePartial(t *testing.T) {
+	srv := clienttest.NewServer()
+	defer srv.Close()
+	srv.PutFile("demo", "a.txt", []byte("hello"), time.Now().Unix())
+	f, _ := srv.File("demo", "a.txt")
+
+	// 临时文件比远程文件还长，续传请求的区间无法满足，服务器返回 416
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	partPath, metaPath := downloadTempPaths("demo", "a.txt", localPath)
+	if err := os.WriteFile(partPath, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := json.Marshal(partialDownload{RemotePath: "a.txt", Validator: `"` + f.Hash() + `"`})
+	if err := os.WriteFile(metaPath, meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(srv.URL, StaticToken(srv.Token()))
+	c.Retry = RetryPolicy{MaxAttempts: 1}
+	if err := c.Download(context.Background(), "demo", "a.txt", localPath, f.Hash()); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if data, _ := os.ReadFile(localPath); string(data) != "hello" {
+		t.Errorf("a.txt = %q, want hello", data)
+	}
+	if n := srv.CountRequests("GET /file/download"); n != 2 {
+		t.Errorf("server received %d downloads, want the ranged request and one full download", n)
+	}
+	for _, path := range []string{partPath, metaPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", filepath.Base(path), err)
+		}
+	}
+}
@@ -2,353 +2,233 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
-	"github.com/litongjava/hfile/config"
-	"github.com/litongjava/hfile/model"
 	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"os"
-	"path/filepath"
+	pathpkg "path"
+	"sort"
 	"strconv"
-	"time"
+	"strings"
+
+	"github.com/litongjava/hfile/model"
+	"github.com/litongjava/hfile/utils"
 )
 
-const ChunkSize = 10 * 1024 * 1024 // 10 MB
+const (
+	DefaultChunkSize = 10 * 1024 * 1024 // 10 MB
+	DefaultChunkJobs = 4
+	// ChunkThreshold 以上的文件使用分片上传
+	ChunkThreshold = 100 * 1024 * 1024
+)
 
-func Register(url, username, password string) {
-	reqBody := model.RegisterRequest{
-		Username:         username,
-		Password:         password,
-		UserType:         1,
-		VerificationType: 0, // 不验证邮箱
-	}
+// ErrRenameUnsupported 表示服务器没有提供重命名仓库的接口
+var ErrRenameUnsupported = errors.New("server does not support renaming repositories")
 
-	jsonData, _ := json.Marshal(reqBody)
+// Repo 是一个远程仓库
+type Repo struct {
+	Name string `json:"name"`
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		os.Exit(1)
+// UnmarshalJSON 接受仓库名字符串或 {"name": ...} 对象
+func (r *Repo) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		r.Name = name
+		return nil
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if apiResp.Ok {
-		fmt.Println("✅ Successfully!")
-	} else {
-		fmt.Printf("❌ Failed: %s\n", string(body))
-		if data, ok := apiResp.Data.([]interface{}); ok {
-			for _, item := range data {
-				if fieldMap, ok := item.(map[string]interface{}); ok {
-					field := fieldMap["field"]
-					messages := fieldMap["messages"]
-					fmt.Println("error:", field, " ", messages)
+	type plain Repo
+	return json.Unmarshal(data, (*plain)(r))
+}
 
-				}
-			}
+// Repos 返回当前用户的远程仓库
+func (c *Client) Repos(ctx context.Context) ([]Repo, error) {
+	var repos []Repo
+	err := c.withRetry(ctx, "list repositories", func() error {
+		req, err := c.newRequest(ctx, "GET", RepoListPath, nil, nil)
+		if err != nil {
+			return err
 		}
+		return c.doJSON(req, &repos)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return repos, nil
 }
 
-func Login(url, username, password string) {
-	reqBody := model.LoginRequest{
-		Username: username,
-		Password: password,
-	}
-
-	jsonData, _ := json.Marshal(reqBody)
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// RenameRepo 在服务器上把远程仓库 repo 重命名为 newName
+func (c *Client) RenameRepo(ctx context.Context, repo, newName string) error {
+	query := neturl.Values{"repo": {repo}, "new_name": {newName}}
+	req, err := c.newRequest(ctx, "POST", RepoRenamePath, query, nil)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if apiResp.Ok {
-		fmt.Println("✅ Successfully!")
-		// 解析 data 字段
-		data, ok := apiResp.Data.(map[string]interface{})
-		if !ok {
-			fmt.Println("❌ Failed to parse data field")
-			os.Exit(1)
-		}
-
-		token, _ := data["token"].(string)
-		refreshToken, _ := data["refresh_token"].(string)
-
-		// 保存 token 到配置文件
-		if err := config.SaveToken(token, refreshToken); err != nil {
-			fmt.Println("❌ Failed to save token:", err)
-			os.Exit(1)
-		}
-	} else {
-		fmt.Printf("❌ Failed: %s\n", string(body))
+		return err
 	}
-}
-
-func Profile(url string, token string) {
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if apiResp.Ok {
-		bytes, err := json.MarshalIndent(apiResp.Data.(interface{}), "", "  ")
-		if err != nil {
-			hlog.Error(err.Error())
-		}
-		fmt.Println("✅ Successfully!")
-		fmt.Println(string(bytes))
-	} else {
-		hlog.Errorf(string(body))
-	}
-}
-
-func RepoList(url string, token string) {
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		return
+		return err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if apiResp.Ok {
-		fmt.Println("✅ Successfully!")
-		repos := apiResp.Data.([]interface{})
-		for i, repo := range repos {
-			fmt.Printf("[%d] %s\n", i+1, repo)
-		}
-	} else {
-		fmt.Println("❌ Failed")
-		hlog.Errorf(string(body))
+	// 没有 JSON 响应的 404/405 说明接口不存在，而不是仓库不存在
+	if isUnsupported(resp.StatusCode, body) {
+		return ErrRenameUnsupported
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := decodeResponse(resp, nil); err != nil {
+		return fmt.Errorf("rename failed: %w", err)
 	}
+	return nil
 }
 
-func FetchRemoteFiles(serverURL, token, repo string) (map[string]model.FileMeta, error) {
-	url := fmt.Sprintf("%s/file/list?repo=%s", serverURL, repo)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
+// remoteEntry 是 /file/list 返回的一项，mod_time 为 Unix 秒，服务器以字符串返回，也接受数字
+type remoteEntry struct {
+	Path    string          `json:"path"`
+	Hash    string          `json:"hash"`
+	ModTime json.RawMessage `json:"mod_time"`
+	Size    int64           `json:"size"`
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Files 返回远程仓库中的文件，按路径排序
+func (c *Client) Files(ctx context.Context, repo string) ([]model.FileMeta, error) {
+	var entries []remoteEntry
+	err := c.withRetry(ctx, "list files of "+repo, func() error {
+		req, err := c.newRequest(ctx, "GET", "/file/list", repoQuery(repo), nil)
+		if err != nil {
+			return err
+		}
+		return c.doJSON(req, &entries)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("server error: %s", string(body))
-	}
 
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if !apiResp.Ok {
-		return nil, fmt.Errorf("API error: %s", *apiResp.Msg)
-	}
-
-	remoteMap := make(map[string]model.FileMeta)
-	data, ok := apiResp.Data.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid data format")
-	}
-
-	for _, item := range data {
-		m := item.(map[string]interface{})
-		path := m["path"].(string)
-		hash := m["hash"].(string)
-		raw := m["mod_time"]
-		v := raw.(string)
-		modTime, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			// 处理解析错误
-			log.Fatalf("parse mod_time failed: %v", err)
+	files := make([]model.FileMeta, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("file entry without path")
 		}
-		remoteMap[path] = model.FileMeta{
-			Path:    path,
-			Hash:    hash,
-			ModTime: modTime,
+		// 远程路径会直接拼接到本地仓库目录下，拒绝可能写到仓库外或 .hfile 内的路径
+		if err := checkRemotePath(entry.Path); err != nil {
+			return nil, err
 		}
+		modTime, err := parseModTime(entry.ModTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mod_time %s for %s", entry.ModTime, entry.Path)
+		}
+		files = append(files, model.FileMeta{Path: entry.Path, Hash: entry.Hash, ModTime: modTime, Size: entry.Size})
 	}
-
-	return remoteMap, nil
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
 }
 
-func UploadFile(serverURL, token, repo, filePath string, modTime int64) error {
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return err
-	}
-
-	if fileInfo.Size() > 100*1024*1024 {
-		return UploadInChunks(serverURL, token, repo, filePath)
+// checkRemotePath 检查远程路径是否为仓库内的相对路径：
+// 不能是绝对路径，不能包含 ..、. 或空的路径段，也不能位于 .hfile 目录下
+func checkRemotePath(p string) error {
+	if pathpkg.IsAbs(p) || strings.Contains(p, "\\") || (len(p) >= 2 && p[1] == ':') {
+		return fmt.Errorf("unsafe remote path %q: must be relative to the repository", p)
 	}
-
-	url := fmt.Sprintf("%s/file/upload?repo=%s", serverURL, repo)
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, _ := writer.CreateFormFile("file", filePath)
-	io.Copy(part, file)
-	_ = writer.WriteField("original_mod_time", strconv.FormatInt(modTime, 10))
-	writer.Close()
-
-	req, _ := http.NewRequest("POST", url, body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("unsafe remote path %q: invalid path segment %q", p, segment)
+		}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upload failed: %s", string(body))
+	if first, _, _ := strings.Cut(p, "/"); strings.EqualFold(first, ".hfile") {
+		return fmt.Errorf("unsafe remote path %q: inside .hfile", p)
 	}
 	return nil
 }
 
-func DownloadFile(serverURL, token, repo, remotePath string) error {
-	localPath := remotePath
-	dir := filepath.Dir(localPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+// parseModTime 解析字符串或数字形式的 Unix 秒
+func parseModTime(raw json.RawMessage) (int64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strconv.ParseInt(s, 10, 64)
 	}
-
-	url := fmt.Sprintf("%s/file/download?repo=%s&file=%s", serverURL, repo, remotePath)
-
-	var start int64 = 0
-	if stat, err := os.Stat(localPath); err == nil {
-		start = stat.Size()
+	var f float64
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return 0, err
 	}
+	return int64(f), nil
+}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	if start > 0 {
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+// FileMap 按路径索引文件列表
+func FileMap(files []model.FileMeta) map[string]model.FileMeta {
+	m := make(map[string]model.FileMeta, len(files))
+	for _, file := range files {
+		m[file.Path] = file
 	}
+	return m
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Upload 上传本地文件 localPath，remotePath 为仓库内的相对路径，超过 ChunkThreshold 时分片上传。
+// hash 为文件内容的 SHA-256，随请求一起发送供服务器校验，为空时现场计算。
+func (c *Client) Upload(ctx context.Context, repo, localPath, remotePath string, modTime int64, hash string) error {
+	fileInfo, err := os.Stat(localPath)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 416 {
-		// 已下载完毕
-		return nil
-	}
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code:%d", resp.StatusCode)
-	}
-
-	// 获取服务器端的文件修改时间
-	lastModified := resp.Header.Get("Last-Modified")
-	var serverModTime time.Time
-	if lastModified != "" {
-		// 尝试多种时间格式解析
-		formats := []string{"Mon, 2 Jan 2006 15:04:05 MST"}
-
-		var parseErr error
-		for _, format := range formats {
-			serverModTime, parseErr = time.Parse(format, lastModified)
-			if parseErr == nil {
-				break
-			}
-		}
 
-		if parseErr != nil {
-			hlog.Warnf("Failed to parse Last-Modified header with all formats: %v, value: %s", parseErr, lastModified)
+	if hash == "" {
+		if hash, err = utils.HashFile(localPath); err != nil {
+			return fmt.Errorf("failed to hash file: %w", err)
 		}
 	}
-	mode := os.O_CREATE | os.O_WRONLY
-	if start > 0 {
-		mode |= os.O_APPEND
-	}
 
-	file, err := os.OpenFile(localPath, mode, 0755)
-	if err != nil {
-		return err
+	if fileInfo.Size() > ChunkThreshold {
+		return c.UploadInChunks(ctx, repo, localPath, remotePath, hash)
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
-
-	// 设置本地文件的修改时间与服务器端一致
-	if !serverModTime.IsZero() {
-		err = os.Chtimes(localPath, time.Now(), serverModTime)
+	open := func() (io.ReadCloser, error) {
+		return os.Open(localPath)
+	}
+	// 同一内容上传到同一路径可以安全地重复
+	err = c.withRetry(ctx, "upload "+remotePath, func() error {
+		req, err := c.newMultipartRequest(ctx, "/file/upload", repoQuery(repo), remotePath, fileInfo.Size(), open,
+			formField{"original_mod_time", strconv.FormatInt(modTime, 10)},
+			formField{"hash", hash})
 		if err != nil {
-			hlog.Warnf("Failed to set file mod time: %v", err)
+			return err
 		}
+		return c.doJSON(req, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
 	}
-	return err
+	return nil
 }
 
-func CompareForUpload(localFiles, remoteFiles map[string]model.FileMeta) []model.FileMeta {
-	var result []model.FileMeta
-	for path, l := range localFiles {
-		if r, ok := remoteFiles[path]; ok {
-			if l.Hash != r.Hash && l.ModTime > r.ModTime {
-				result = append(result, l)
-			}
-		} else {
-			result = append(result, l)
+// Delete 删除远程仓库中的文件
+func (c *Client) Delete(ctx context.Context, repo, remotePath string) error {
+	query := neturl.Values{"repo": {repo}, "file": {remotePath}}
+	// 服务器上删除不存在的文件也返回成功，可以安全地重复
+	err := c.withRetry(ctx, "delete "+remotePath, func() error {
+		req, err := c.newRequest(ctx, "POST", "/file/delete", query, nil)
+		if err != nil {
+			return err
 		}
+		return c.doJSON(req, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
 	}
-	return result
+	return nil
 }
 
-func CompareForDownload(local, remote map[string]model.FileMeta) []model.FileMeta {
-	var result []model.FileMeta
-	for path, r := range remote {
-		if l, ok := local[path]; ok {
-			if r.Hash != l.Hash && r.ModTime > l.ModTime {
-				result = append(result, r)
-			}
-		} else {
-			result = append(result, r)
-		}
+// statusError 把非 200/206 的下载响应转换为 *APIError
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxPeekSize))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := decodeResponse(resp, nil); err != nil {
+		return err
 	}
-	return result
+	return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 }
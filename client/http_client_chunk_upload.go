@@ -1,21 +1,45 @@
 package client
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
-	"github.com/litongjava/hfile/model"
 	"io"
-	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"sync"
+
+	"github.com/litongjava/hfile/model"
+	"github.com/litongjava/hfile/utils"
 )
 
-// 支持上传ID的分片上传
-func UploadInChunks(serverURL, token, repo, filePath string) error {
-	file, err := os.Open(filePath)
+// ChunkOptions 控制分片上传的分片大小和单个文件内的并发分片数
+type ChunkOptions struct {
+	Size int64
+	Jobs int
+}
+
+// chunkOptions 返回 c.Chunks，非正数的字段使用默认值
+func (c *Client) chunkOptions() ChunkOptions {
+	opts := c.Chunks
+	if opts.Size <= 0 {
+		opts.Size = DefaultChunkSize
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = DefaultChunkJobs
+	}
+	return opts
+}
+
+// UploadInChunks 使用上传ID分片上传，分片由固定数量的 goroutine 并发上传。
+// 中断后再次调用会跳过已确认的分片继续上传。
+func (c *Client) UploadInChunks(ctx context.Context, repo, localPath, remotePath, hash string) error {
+	file, err := os.Open(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
@@ -26,178 +50,320 @@ func UploadInChunks(serverURL, token, repo, filePath string) error {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	opts := c.chunkOptions()
 	fileSize := fileInfo.Size()
-	totalParts := int((fileSize + ChunkSize - 1) / ChunkSize)
+	totalParts := int((fileSize + opts.Size - 1) / opts.Size)
 	modTime := fileInfo.ModTime().Unix()
 
-	hlog.Infof("Start chunk upload: file=%s, size=%d, chunks=%d", filePath, fileSize, totalParts)
+	if hash == "" {
+		if hash, err = utils.HashFile(localPath); err != nil {
+			return fmt.Errorf("failed to hash file: %w", err)
+		}
+	}
 
-	// 1. 初始化分片上传，获取upload_id
-	uploadID, err := initChunkedUpload(serverURL, token, repo, filePath, fileSize, totalParts, modTime)
-	if err != nil {
-		return fmt.Errorf("failed to init chunked upload: %w", err)
+	c.logger().Infof("Start chunk upload: file=%s, size=%d, chunks=%d", remotePath, fileSize, totalParts)
+
+	// 1. 查找可续传的上传，文件已变化或服务器不再认识该 upload_id 时重新初始化
+	var repoRoot string
+	if root, err := utils.GetRepoRoot(filepath.Dir(localPath)); err == nil {
+		repoRoot = root
 	}
+	statePath := uploadStatePath(repoRoot, c.BaseURL, repo, remotePath)
+	state := c.resumeUploadState(ctx, repo, statePath, fileSize, fileInfo.ModTime().UnixNano(), hash, opts.Size)
 
-	// 2. 逐个上传分片
-	for partIndex := 0; partIndex < totalParts; partIndex++ {
-		start := int64(partIndex) * ChunkSize
-		end := start + ChunkSize
-		if end > fileSize {
-			end = fileSize
+	if state == nil {
+		uploadID, err := c.initChunkedUpload(ctx, repo, remotePath, fileSize, totalParts, modTime, hash)
+		if err != nil {
+			return fmt.Errorf("failed to init chunked upload: %w", err)
 		}
-
-		chunk := make([]byte, end-start)
-		_, err := file.ReadAt(chunk, start)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("failed to read chunk %d: %w", partIndex, err)
+		state = &uploadState{
+			UploadID:   uploadID,
+			Server:     c.BaseURL,
+			Repo:       repo,
+			RemotePath: remotePath,
+			Size:       fileSize,
+			ModTimeNs:  fileInfo.ModTime().UnixNano(),
+			Hash:       hash,
+			ChunkSize:  opts.Size,
+			TotalParts: totalParts,
+			path:       statePath,
+		}
+		if err := state.save(); err != nil {
+			c.logger().Warnf("Failed to save upload state for %s: %v", remotePath, err)
 		}
+	} else {
+		c.logger().Infof("Resuming upload %s: %d/%d chunks already uploaded", state.UploadID, len(state.Parts), totalParts)
+	}
 
-		err = uploadChunk(serverURL, token, repo, uploadID, partIndex, chunk, filePath)
-		if err != nil {
-			return fmt.Errorf("failed to upload chunk %d: %w", partIndex, err)
+	// 2. 并发上传未确认的分片
+	acked := state.acked()
+	pending := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		uploaded = len(state.Parts)
+	)
+
+	jobs := opts.Jobs
+	if missing := totalParts - len(acked); jobs > missing {
+		jobs = missing
+	}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partIndex := range pending {
+				part, err := c.uploadPart(ctx, repo, state.UploadID, file, partIndex, opts.Size, fileSize, remotePath)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					if err := state.markAcked(part); err != nil {
+						c.logger().Warnf("Failed to save upload state for %s: %v", remotePath, err)
+					}
+					uploaded++
+					c.logger().Infof("Chunk %d uploaded successfully (%d/%d)", partIndex+1, uploaded, totalParts)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for partIndex := 0; partIndex < totalParts; partIndex++ {
+		if acked[partIndex] {
+			continue
+		}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed || ctx.Err() != nil {
+			break
 		}
+		select {
+		case pending <- partIndex:
+		case <-ctx.Done():
+		}
+	}
+	close(pending)
+	wg.Wait()
 
-		hlog.Infof("Chunk %d/%d uploaded successfully", partIndex+1, totalParts)
+	// 被取消时已确认的分片都已记录在状态文件中，下次调用从这里继续
+	if err := ctx.Err(); err != nil {
+		if state.path != "" {
+			c.logger().Infof("Upload of %s interrupted, %d/%d chunks saved for resume", remotePath, len(state.Parts), totalParts)
+		}
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
 	}
 
-	// 3. 完成分片上传
-	err = completeChunkedUpload(serverURL, token, repo, uploadID)
+	// 3. 完成分片上传，提交每个分片的 ETag 供服务器校验拼接顺序
+	err = c.completeChunkedUpload(ctx, repo, state.UploadID, state.Parts)
 	if err != nil {
 		return fmt.Errorf("failed to complete chunked upload: %w", err)
 	}
+	state.remove()
 
-	hlog.Infof("All chunks uploaded and merged successfully for file: %s", filePath)
+	c.logger().Infof("All chunks uploaded and merged successfully for file: %s", remotePath)
 	return nil
 }
 
-// 初始化分片上传
-func initChunkedUpload(serverURL, token, repo, fileName string, fileSize int64, totalParts int, modTime int64) (string, error) {
-	url := fmt.Sprintf("%s/file/upload/init?repo=%s", serverURL, repo)
-
-	reqBody := map[string]interface{}{
-		"repo":              repo,
-		"file_name":         fileName,
-		"file_size":         fileSize,
-		"total_parts":       totalParts,
-		"original_mod_time": modTime,
+// uploadPart 上传一个分片，分片内容直接从文件区间流式读取
+func (c *Client) uploadPart(ctx context.Context, repo, uploadID string, file *os.File, partIndex int,
+	chunkSize, fileSize int64, fileName string) (model.CompletedPart, error) {
+	start := int64(partIndex) * chunkSize
+	end := start + chunkSize
+	if end > fileSize {
+		end = fileSize
 	}
 
-	jsonData, _ := json.Marshal(reqBody)
-
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// 服务器按 part_index 保存分片，重复上传同一分片会覆盖之前的内容
+	var resp model.ChunkUploadResponse
+	op := fmt.Sprintf("upload chunk %d of %s", partIndex+1, fileName)
+	err := c.withRetry(ctx, op, func() (err error) {
+		resp, err = c.uploadChunk(ctx, repo, uploadID, partIndex, file, start, end-start, fileName)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return model.CompletedPart{}, fmt.Errorf("failed to upload chunk %d: %w", partIndex, err)
 	}
-	defer resp.Body.Close()
+	return model.CompletedPart{PartIndex: partIndex, ETag: resp.ETag}, nil
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("init failed with status %d: %s", resp.StatusCode, string(body))
+// resumeUploadState 读取已保存的上传状态，并与服务器已接收的分片对齐。
+// 文件发生变化或服务器已丢弃该上传时删除状态并返回 nil。
+func (c *Client) resumeUploadState(ctx context.Context, repo, statePath string, fileSize, modTimeNs int64, hash string, chunkSize int64) *uploadState {
+	state, err := loadUploadState(statePath)
+	if err != nil {
+		c.logger().Warnf("Discarding unreadable upload state %s: %v", statePath, err)
 	}
-
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if !apiResp.Ok {
-		return "", fmt.Errorf("init failed: %s", *apiResp.Msg)
+	if state == nil {
+		return nil
 	}
 
-	data, ok := apiResp.Data.(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid init response format")
+	// upload_id 只在签发它的服务器上有效，记录的服务器不一致时不能续传
+	if state.Server != c.BaseURL || state.Repo != repo {
+		c.logger().Infof("Upload %s belongs to another server or repository, starting over", state.UploadID)
+		state.remove()
+		return nil
+	}
+	if !state.matches(fileSize, modTimeNs, hash, chunkSize) {
+		c.logger().Infof("File changed since upload %s started, starting over", state.UploadID)
+		state.remove()
+		return nil
 	}
 
-	uploadID, ok := data["upload_id"].(string)
-	if !ok {
-		return "", fmt.Errorf("upload_id not found in response")
+	parts, err := c.fetchUploadedParts(ctx, repo, state.UploadID)
+	switch {
+	case err == errUploadStatusUnsupported:
+		// 服务器不支持查询时以本地记录为准
+		return state
+	case ctx.Err() != nil:
+		// 查询被取消不代表上传失效，保留状态留给下次续传
+		return state
+	case err != nil:
+		c.logger().Infof("Upload %s can not be resumed (%v), starting over", state.UploadID, err)
+		state.remove()
+		return nil
 	}
 
-	return uploadID, nil
+	// 以服务器记录为准，服务器没有返回 ETag 时沿用本地保存的值
+	etags := make(map[int]string, len(state.Parts))
+	for _, part := range state.Parts {
+		etags[part.PartIndex] = part.ETag
+	}
+	state.Parts = state.Parts[:0]
+	for _, part := range parts {
+		if part.PartIndex < 0 || part.PartIndex >= state.TotalParts {
+			continue
+		}
+		if part.ETag == "" {
+			part.ETag = etags[part.PartIndex]
+		}
+		state.Parts = append(state.Parts, part)
+	}
+	sort.Slice(state.Parts, func(i, j int) bool { return state.Parts[i].PartIndex < state.Parts[j].PartIndex })
+	if err := state.save(); err != nil {
+		c.logger().Warnf("Failed to save upload state: %v", err)
+	}
+	return state
 }
 
-// 上传单个分片
-func uploadChunk(serverURL, token, repo, uploadID string, partIndex int, chunk []byte, fileName string) error {
-	url := fmt.Sprintf("%s/file/upload/chunk?repo=%s", serverURL, repo)
+var errUploadStatusUnsupported = errors.New("upload status not supported by server")
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// uploadStatus 是 /file/upload/status 返回的 data，parts 中的元素可以是序号或 {part_index, etag}
+type uploadStatus struct {
+	Parts []json.RawMessage `json:"parts"`
+}
 
-	part, err := writer.CreateFormFile("file", fileName)
-	if err != nil {
-		return err
+// fetchUploadedParts 查询服务器已接收的分片
+func (c *Client) fetchUploadedParts(ctx context.Context, repo, uploadID string) ([]model.CompletedPart, error) {
+	query := neturl.Values{"repo": {repo}, "upload_id": {uploadID}}
+	var status uploadStatus
+	err := c.withRetry(ctx, "query upload "+uploadID, func() error {
+		req, err := c.newRequest(ctx, "GET", "/file/upload/status", query, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+			return errUploadStatusUnsupported
+		}
+		return decodeResponse(resp, &status)
+	})
+	if err == errUploadStatusUnsupported {
+		return nil, err
 	}
-	_, err = part.Write(chunk)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("status failed: %w", err)
 	}
 
-	_ = writer.WriteField("upload_id", uploadID)
-	_ = writer.WriteField("part_index", strconv.Itoa(partIndex))
-	writer.Close()
-
-	req, _ := http.NewRequest("POST", url, body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+token)
+	parts := make([]model.CompletedPart, 0, len(status.Parts))
+	for _, raw := range status.Parts {
+		var index int
+		if json.Unmarshal(raw, &index) == nil {
+			parts = append(parts, model.CompletedPart{PartIndex: index})
+			continue
+		}
+		var part struct {
+			PartIndex *int   `json:"part_index"`
+			ETag      string `json:"etag"`
+		}
+		if json.Unmarshal(raw, &part) == nil && part.PartIndex != nil {
+			parts = append(parts, model.CompletedPart{PartIndex: *part.PartIndex, ETag: part.ETag})
+		}
+	}
+	return parts, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// initChunkedUpload 初始化分片上传，返回 upload_id
+func (c *Client) initChunkedUpload(ctx context.Context, repo, fileName string, fileSize int64, totalParts int, modTime int64, hash string) (string, error) {
+	reqBody := map[string]interface{}{
+		"repo":              repo,
+		"file_name":         fileName,
+		"file_size":         fileSize,
+		"total_parts":       totalParts,
+		"original_mod_time": modTime,
+		"hash":              hash,
+	}
+	req, err := c.newJSONRequest(ctx, "POST", "/file/upload/init", repoQuery(repo), reqBody)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("chunk upload failed with status %d: %s", resp.StatusCode, string(respBody))
+	var data struct {
+		UploadID string `json:"upload_id"`
 	}
-
-	var apiResp model.APIResponse
-	json.Unmarshal(respBody, &apiResp)
-
-	if !apiResp.Ok {
-		return fmt.Errorf("chunk upload failed: %s", *apiResp.Msg)
+	if err := c.doJSON(req, &data); err != nil {
+		return "", err
 	}
-
-	return nil
+	if data.UploadID == "" {
+		return "", fmt.Errorf("upload_id not found in response")
+	}
+	return data.UploadID, nil
 }
 
-// 完成分片上传
-func completeChunkedUpload(serverURL, token, repo, uploadID string) error {
-	url := fmt.Sprintf("%s/file/upload/complete?repo=%s", serverURL, repo)
+// uploadChunk 上传单个分片，file 由多个分片共享，只通过 ReadAt 读取
+func (c *Client) uploadChunk(ctx context.Context, repo, uploadID string, partIndex int, file *os.File, offset, length int64,
+	fileName string) (model.ChunkUploadResponse, error) {
+	var result model.ChunkUploadResponse
 
-	reqBody := map[string]interface{}{
-		"upload_id": uploadID,
+	open := func() (io.ReadCloser, error) {
+		return sectionReadCloser{SectionReader: io.NewSectionReader(file, offset, length)}, nil
 	}
-
-	jsonData, _ := json.Marshal(reqBody)
-
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req, err := c.newMultipartRequest(ctx, "/file/upload/chunk", repoQuery(repo), fileName, length, open,
+		formField{"upload_id", uploadID},
+		formField{"part_index", strconv.Itoa(partIndex)})
 	if err != nil {
-		return err
+		return result, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("complete failed with status %d: %s", resp.StatusCode, string(body))
+	// data 中的 etag 为可选字段，旧版本服务器不返回
+	if err := c.doJSON(req, &result); err != nil {
+		return result, err
 	}
+	result.PartIndex = partIndex
+	return result, nil
+}
 
-	var apiResp model.APIResponse
-	json.Unmarshal(body, &apiResp)
-
-	if !apiResp.Ok {
-		return fmt.Errorf("complete failed: %s", *apiResp.Msg)
+// completeChunkedUpload 完成分片上传
+func (c *Client) completeChunkedUpload(ctx context.Context, repo, uploadID string, parts []model.CompletedPart) error {
+	req, err := c.newJSONRequest(ctx, "POST", "/file/upload/complete", repoQuery(repo), model.CompleteUploadRequest{
+		UploadID: uploadID,
+		Parts:    parts,
+	})
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return c.doJSON(req, nil)
 }
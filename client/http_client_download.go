@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/litongjava/hfile/utils"
+)
+
+// partialDownload 记录 .part 临时文件对应的远程版本，续传时作为 If-Range 的校验值
+type partialDownload struct {
+	RemotePath string `json:"remote_path"`
+	Validator  string `json:"validator"`
+}
+
+// downloadTempPaths 返回临时文件和元数据文件的路径。
+// 位于仓库内时使用 .hfile/tmp/<id>.part，否则放在目标文件旁边，保证可以原子重命名。
+func downloadTempPaths(repo, remotePath, localPath string) (string, string) {
+	sum := sha256.Sum256([]byte(repo + "\x00" + remotePath))
+	id := hex.EncodeToString(sum[:16])
+
+	if root, err := utils.GetRepoRoot(filepath.Dir(localPath)); err == nil {
+		tmpDir := filepath.Join(root, ".hfile", "tmp")
+		return filepath.Join(tmpDir, id+".part"), filepath.Join(tmpDir, id+".json")
+	}
+	dir := filepath.Dir(localPath)
+	return filepath.Join(dir, "."+id+".part"), filepath.Join(dir, "."+id+".json")
+}
+
+// Download 下载仓库内的 remotePath 到本地文件 localPath。
+// 内容先写入临时文件，校验 SHA-256 后再重命名覆盖目标，目标文件不会出现半个文件。
+// 响应头 X-Content-SHA256 优先于 expectedHash，两者都为空时不校验。
+// 下载中断后按 c.Retry 重试，重试时从临时文件的末尾继续，服务器拒绝续传的区间时从头下载。
+func (c *Client) Download(ctx context.Context, repo, remotePath, localPath, expectedHash string) error {
+	return c.withRetry(ctx, "download "+remotePath, func() error {
+		return c.download(ctx, repo, remotePath, localPath, expectedHash)
+	})
+}
+
+func (c *Client) download(ctx context.Context, repo, remotePath, localPath, expectedHash string) error {
+	partPath, metaPath := downloadTempPaths(repo, remotePath, localPath)
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	// 只有临时文件和远程版本标识都在时才续传，否则从头下载
+	var start int64
+	var meta partialDownload
+	if stat, err := os.Stat(partPath); err == nil {
+		if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, &meta) == nil &&
+			meta.RemotePath == remotePath && meta.Validator != "" {
+			start = stat.Size()
+		}
+	}
+	if start == 0 {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		meta = partialDownload{}
+	}
+
+	query := neturl.Values{"repo": {repo}, "file": {remotePath}}
+	req, err := c.newRequest(ctx, "GET", "/file/download", query, nil)
+	if err != nil {
+		return err
+	}
+	if start > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+		req.Header.Set("If-Range", meta.Validator)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	mode := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 服务器返回完整内容（文件已变化或不支持续传），覆盖临时文件
+		mode |= os.O_TRUNC
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", start)) {
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			return fmt.Errorf("unexpected Content-Range %q for %s", resp.Header.Get("Content-Range"), remotePath)
+		}
+		mode |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if start == 0 {
+			return statusError(resp)
+		}
+		// 临时文件与远程不一致，丢弃后从头重新下载
+		resp.Body.Close()
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		return c.download(ctx, repo, remotePath, localPath, expectedHash)
+	default:
+		return statusError(resp)
+	}
+
+	if header := resp.Header.Get("X-Content-SHA256"); header != "" {
+		expectedHash = header
+	}
+
+	// 记录本次内容的版本标识，中断后续传时用 If-Range 确认远程没有变化
+	if resp.StatusCode == http.StatusOK {
+		meta = partialDownload{RemotePath: remotePath, Validator: resp.Header.Get("ETag")}
+		if meta.Validator == "" && expectedHash != "" {
+			meta.Validator = `"` + expectedHash + `"`
+		}
+		if data, err := json.Marshal(meta); err == nil {
+			os.WriteFile(metaPath, data, 0644)
+		}
+	}
+
+	// 获取服务器端的文件修改时间
+	lastModified := resp.Header.Get("Last-Modified")
+	var serverModTime time.Time
+	if lastModified != "" {
+		// 尝试多种时间格式解析
+		formats := []string{"Mon, 2 Jan 2006 15:04:05 MST"}
+
+		var parseErr error
+		for _, format := range formats {
+			serverModTime, parseErr = time.Parse(format, lastModified)
+			if parseErr == nil {
+				break
+			}
+		}
+
+		if parseErr != nil {
+			c.logger().Warnf("Failed to parse Last-Modified header with all formats: %v, value: %s", parseErr, lastModified)
+		}
+	}
+
+	file, err := os.OpenFile(partPath, mode, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// 保留临时文件，下次从断点继续
+		return err
+	}
+
+	if expectedHash != "" {
+		actual, err := utils.HashFile(partPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", remotePath, err)
+		}
+		if !strings.EqualFold(actual, expectedHash) {
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			return fmt.Errorf("content hash mismatch for %s: expected %s, got %s", remotePath, expectedHash, actual)
+		}
+	}
+
+	// 设置本地文件的修改时间与服务器端一致
+	if !serverModTime.IsZero() {
+		if err := os.Chtimes(partPath, time.Now(), serverModTime); err != nil {
+			c.logger().Warnf("Failed to set file mod time: %v", err)
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", remotePath, err)
+	}
+	os.Remove(metaPath)
+	return nil
+}
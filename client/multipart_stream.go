@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"sync"
+)
+
+// formField 是 multipart 表单中的普通字段
+type formField struct {
+	name  string
+	value string
+}
+
+// copyBufferPool 复用流式上传时的拷贝缓冲区
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 256*1024)
+		return &buf
+	},
+}
+
+// countingWriter 只统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// newMultipartRequest 创建一个流式的 multipart 上传请求。
+// 文件内容通过 io.Pipe 边读边发，内存占用与文件大小无关；
+// open 每次调用都返回一份新的文件内容，用于设置 GetBody 以便请求可以重发。
+func (c *Client) newMultipartRequest(ctx context.Context, path string, query neturl.Values, fileName string, size int64,
+	open func() (io.ReadCloser, error), fields ...formField) (*http.Request, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	length, err := multipartLength(boundary, fileName, size, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	getBody := func() (io.ReadCloser, error) {
+		content, err := open()
+		if err != nil {
+			return nil, err
+		}
+		pr, pw := io.Pipe()
+		go func() {
+			defer content.Close()
+			pw.CloseWithError(writeMultipart(pw, boundary, fileName, content, fields))
+		}()
+		return pr, nil
+	}
+
+	body, err := getBody()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, "POST", path, query, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req.ContentLength = length
+	req.GetBody = getBody
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	return req, nil
+}
+
+// writeMultipart 依次写入文件和字段
+func writeMultipart(w io.Writer, boundary, fileName string, content io.Reader, fields []formField) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		buf := copyBufferPool.Get().(*[]byte)
+		_, err = io.CopyBuffer(part, content, *buf)
+		copyBufferPool.Put(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range fields {
+		if err := writer.WriteField(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// multipartLength 计算请求体的总长度：表单结构的字节数加上文件大小
+func multipartLength(boundary, fileName string, size int64, fields []formField) (int64, error) {
+	counter := &countingWriter{}
+	if err := writeMultipart(counter, boundary, fileName, nil, fields); err != nil {
+		return 0, err
+	}
+	return counter.n + size, nil
+}
+
+// sectionReadCloser 让文件的一个区间可以作为请求体读取并关闭
+type sectionReadCloser struct {
+	*io.SectionReader
+	file io.Closer
+}
+
+func (s sectionReadCloser) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts  = 4
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultRetryMaxDelay  = 30 * time.Second
+	DefaultRetryJitter    = 0.2
+)
+
+// RetryPolicy 控制临时错误（连接失败、响应中断、408/429/5xx）的重试。
+// 第 n 次重试前等待 BaseDelay*2^(n-1)，不超过 MaxDelay，并按 Jitter 随机浮动；
+// 服务器返回 Retry-After 时按它等待，同样不超过 MaxDelay。只有可以安全重复的请求才会重试：
+// 查询、下载、删除、整个文件上传和分片上传。
+type RetryPolicy struct {
+	// MaxAttempts 是包括第一次在内的最多尝试次数，小于等于 1 时不重试
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter 是等待时间随机浮动的比例，0.2 表示在 ±20% 之间
+	Jitter float64
+}
+
+// DefaultRetryPolicy 返回 New 使用的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultRetryAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		Jitter:      DefaultRetryJitter,
+	}
+}
+
+// RetryEvent 描述一次即将进行的重试，传给 Client.OnRetry
+type RetryEvent struct {
+	// Op 是被重试的操作，例如 "download big.bin"
+	Op string
+	// Attempt 是即将进行的尝试序号，第一次重试为 2
+	Attempt     int
+	MaxAttempts int
+	// Delay 是重试前等待的时间
+	Delay time.Duration
+	// Err 是上一次尝试的错误
+	Err error
+}
+
+// backoff 返回第 retry 次重试前的等待时间
+func (p RetryPolicy) backoff(retry int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		// 服务器可能要求等待很久，超过 MaxDelay 的部分不等，到时由下一次尝试的结果决定
+		if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return apiErr.RetryAfter
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// withRetry 执行 fn，遇到临时错误时按 c.Retry 等待后重试。
+// fn 每次都要重新创建并发送完整的请求；ctx 取消时立即返回。
+func (c *Client) withRetry(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= c.Retry.MaxAttempts || !temporary(err) {
+			return err
+		}
+		// 已取消时不再报告重试，也不再等待
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		event := RetryEvent{
+			Op:          op,
+			Attempt:     attempt + 1,
+			MaxAttempts: c.Retry.MaxAttempts,
+			Delay:       c.Retry.backoff(attempt, err),
+			Err:         err,
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(ctx, event)
+		} else {
+			c.logger().Debugf("Retrying %s (attempt %d/%d) in %v: %v", op, event.Attempt, event.MaxAttempts, event.Delay, err)
+		}
+
+		timer := time.NewTimer(event.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// temporary 判断 err 是否是值得重试的临时错误
+func temporary(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// 连接被拒绝、重置或超时，以及服务器在响应前关闭连接
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var urlErr *neturl.Error
+	return errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF)
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
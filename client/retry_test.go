@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/client/clienttest"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		name  string
+		retry int
+		err   error
+		want  time.Duration
+	}{
+		{name: "first retry", retry: 1, err: errors.New("reset"), want: 100 * time.Millisecond},
+		{name: "doubles", retry: 3, err: errors.New("reset"), want: 400 * time.Millisecond},
+		{name: "capped by MaxDelay", retry: 10, err: errors.New("reset"), want: time.Second},
+		{name: "Retry-After", retry: 1, err: &APIError{StatusCode: 503, RetryAfter: 300 * time.Millisecond}, want: 300 * time.Millisecond},
+		{name: "Retry-After capped by MaxDelay", retry: 1, err: &APIError{StatusCode: 429, RetryAfter: time.Hour}, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.backoff(tt.retry, tt.err); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterLongerThanMaxDelay(t *testing.T) {
+	srv := clienttest.NewServer()
+	defer srv.Close()
+	srv.Inject(clienttest.Fault{Path: "/repo/list", Kind: clienttest.FaultStatus, Status: 503, RetryAfter: time.Hour, Times: 1})
+
+	c := New(srv.URL, StaticToken(srv.Token()))
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+	start := time.Now()
+	if _, err := c.Repos(context.Background()); err != nil {
+		t.Fatalf("Repos: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Repos took %v, Retry-After was not capped by MaxDelay", elapsed)
+	}
+}
+
+func TestRetryWaitStopsOnCancel(t *testing.T) {
+	srv := clienttest.NewServer()
+	defer srv.Close()
+	srv.Inject(clienttest.Fault{Path: "/repo/list", Kind: clienttest.FaultStatus, Status: 503, RetryAfter: time.Hour})
+
+	c := New(srv.URL, StaticToken(srv.Token()))
+	c.Retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Repos(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Repos error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Repos returned after %v, want it to stop when ctx is done", elapsed)
+	}
+	if n := srv.CountRequests("GET /repo/list"); n != 1 {
+		t.Errorf("server received %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/litongjava/hfile/model"
+	"github.com/litongjava/hfile/utils"
+)
+
+// SyncAction 表示某个路径在本次同步中需要执行的操作
+type SyncAction int
+
+const (
+	ActionNone SyncAction = iota
+	ActionUpload
+	ActionDownload
+	ActionDeleteRemote
+	ActionDeleteLocal
+	ActionConflict
+)
+
+// ConflictStrategy 决定 push/pull 遇到冲突时的处理方式
+type ConflictStrategy int
+
+const (
+	// ConflictKeepBoth 不覆盖任何一侧，pull 时把远程版本另存为冲突副本
+	ConflictKeepBoth ConflictStrategy = iota
+	// ConflictForceLocal 以本地版本为准
+	ConflictForceLocal
+	// ConflictForceRemote 以远程版本为准
+	ConflictForceRemote
+)
+
+// String 返回操作在输出中使用的名称
+func (a SyncAction) String() string {
+	switch a {
+	case ActionUpload:
+		return "upload"
+	case ActionDownload:
+		return "download"
+	case ActionDeleteRemote:
+		return "delete-remote"
+	case ActionDeleteLocal:
+		return "delete-local"
+	case ActionConflict:
+		return "conflict"
+	}
+	return "none"
+}
+
+// DecideAction 以上次同步的状态为基准，对本地和远程做三方比较。
+// local、remote、base 为 nil 表示该侧不存在这个文件。
+func DecideAction(local, remote *model.FileMeta, base *model.SyncEntry) SyncAction {
+	action, _ := ExplainAction(local, remote, base)
+	return action
+}
+
+// ExplainAction 与 DecideAction 相同，同时返回做出该决定的原因
+func ExplainAction(local, remote *model.FileMeta, base *model.SyncEntry) (SyncAction, string) {
+	switch {
+	case local != nil && remote != nil:
+		if base == nil {
+			if local.Hash == remote.Hash {
+				return ActionNone, ""
+			}
+			// 没有基准时无法判断哪一侧被修改过，两侧哈希都已知且不同就是冲突
+			if local.Hash != "" && remote.Hash != "" {
+				return ActionConflict, "differs, no previous sync"
+			}
+			// 缺少哈希时沿用按修改时间比较的规则
+			if local.ModTime > remote.ModTime {
+				return ActionUpload, "local is newer"
+			}
+			if remote.ModTime > local.ModTime {
+				return ActionDownload, "remote is newer"
+			}
+			return ActionNone, ""
+		}
+		localChanged := local.Hash != base.Hash
+		remoteChanged := remote.Hash != base.RemoteHash
+		switch {
+		case localChanged && !remoteChanged:
+			return ActionUpload, "modified locally"
+		case remoteChanged && !localChanged:
+			return ActionDownload, "modified remotely"
+		case localChanged && remoteChanged:
+			// 两侧自上次同步后都有修改，内容相同则无需处理
+			if local.Hash == remote.Hash {
+				return ActionNone, ""
+			}
+			return ActionConflict, "modified locally and remotely"
+		}
+		return ActionNone, ""
+
+	case local != nil:
+		// 上次同步过且本地未修改，说明远程已删除
+		if base != nil && local.Hash == base.Hash {
+			return ActionDeleteLocal, "deleted remotely"
+		}
+		if base != nil {
+			return ActionUpload, "modified locally, deleted remotely"
+		}
+		return ActionUpload, "new local file"
+
+	case remote != nil:
+		// 上次同步过且远程未修改，说明本地已删除
+		if base != nil && remote.Hash == base.RemoteHash {
+			return ActionDeleteRemote, "deleted locally"
+		}
+		if base != nil {
+			return ActionDownload, "modified remotely, deleted locally"
+		}
+		return ActionDownload, "new remote file"
+	}
+	return ActionNone, ""
+}
+
+// CompareForUpload 返回需要上传到远程的本地文件
+func CompareForUpload(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.FileMeta {
+	return collectByAction(local, remote, base, ActionUpload, local)
+}
+
+// CompareForDownload 返回需要下载到本地的远程文件
+func CompareForDownload(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.FileMeta {
+	return collectByAction(local, remote, base, ActionDownload, remote)
+}
+
+// CompareForRemoteDelete 返回本地已删除、需要在远程删除的文件
+func CompareForRemoteDelete(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.FileMeta {
+	return collectByAction(local, remote, base, ActionDeleteRemote, remote)
+}
+
+// CompareForLocalDelete 返回远程已删除、需要在本地删除的文件
+func CompareForLocalDelete(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.FileMeta {
+	return collectByAction(local, remote, base, ActionDeleteLocal, local)
+}
+
+// CompareForConflict 返回自上次同步后本地和远程都被修改的文件
+func CompareForConflict(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.FileMeta {
+	return collectByAction(local, remote, base, ActionConflict, local)
+}
+
+// ConflictCopyPath 生成冲突副本的路径，形如 name.conflict-<host>-<time>
+func ConflictCopyPath(filePath, host string, now time.Time) string {
+	dir, name := pathpkg.Split(filePath)
+	return dir + fmt.Sprintf("%s.conflict-%s-%s", name, host, now.Format("20060102-150405"))
+}
+
+// FindConflictCopy 在仓库 root 中查找 filePath 已有的、内容哈希为 hash 的冲突副本，
+// 找到时返回副本的路径，避免每次 pull 都为同一个远程版本再下载一份。
+func FindConflictCopy(root, filePath, hash string) (string, bool) {
+	if hash == "" {
+		return "", false
+	}
+	dir, name := pathpkg.Split(filePath)
+	entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+	if err != nil {
+		return "", false
+	}
+	prefix := name + ".conflict-"
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		copyPath := dir + entry.Name()
+		actual, err := utils.HashFile(filepath.Join(root, filepath.FromSlash(copyPath)))
+		if err == nil && strings.EqualFold(actual, hash) {
+			return copyPath, true
+		}
+	}
+	return "", false
+}
+
+// BuildStatus 返回所有需要处理的文件，按路径排序
+func BuildStatus(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.StatusEntry {
+	paths := make(map[string]bool)
+	for path := range local {
+		paths[path] = true
+	}
+	for path := range remote {
+		paths[path] = true
+	}
+
+	entries := []model.StatusEntry{}
+	for _, path := range utils.SortedKeys(paths) {
+		var l, r *model.FileMeta
+		var b *model.SyncEntry
+		if v, ok := local[path]; ok {
+			l = &v
+		}
+		if v, ok := remote[path]; ok {
+			r = &v
+		}
+		if v, ok := base[path]; ok {
+			b = &v
+		}
+
+		action, reason := ExplainAction(l, r, b)
+		if action == ActionNone {
+			continue
+		}
+		entry := model.StatusEntry{Path: path, Action: action.String(), Reason: reason}
+		if l != nil {
+			entry.LocalHash = l.Hash
+			entry.LocalSize = &l.Size
+		}
+		if r != nil {
+			entry.RemoteHash = r.Hash
+			entry.RemoteSize = &r.Size
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func collectByAction(local, remote map[string]model.FileMeta, base map[string]model.SyncEntry,
+	action SyncAction, source map[string]model.FileMeta) []model.FileMeta {
+	var result []model.FileMeta
+	for _, path := range utils.SortedKeys(source) {
+		if actionFor(path, local, remote, base) == action {
+			result = append(result, source[path])
+		}
+	}
+	return result
+}
+
+func actionFor(path string, local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) SyncAction {
+	var l, r *model.FileMeta
+	var b *model.SyncEntry
+	if v, ok := local[path]; ok {
+		l = &v
+	}
+	if v, ok := remote[path]; ok {
+		r = &v
+	}
+	if v, ok := base[path]; ok {
+		b = &v
+	}
+	return DecideAction(l, r, b)
+}
+
+// BuildSyncState 根据同步完成后的本地和远程文件计算新的同步状态。
+// done 中的路径本次已成功处理，直接记录两侧当前状态；
+// 其他路径只有在两侧一致、无需任何操作时才记录，否则保留原有基准。
+func BuildSyncState(base map[string]model.SyncEntry, local, remote map[string]model.FileMeta,
+	done map[string]bool) map[string]model.SyncEntry {
+	next := make(map[string]model.SyncEntry, len(base))
+	for path, entry := range base {
+		next[path] = entry
+	}
+
+	paths := make(map[string]bool)
+	for path := range local {
+		paths[path] = true
+	}
+	for path := range remote {
+		paths[path] = true
+	}
+
+	for path := range paths {
+		l, lok := local[path]
+		r, rok := remote[path]
+		if lok && rok && (done[path] || actionFor(path, local, remote, base) == ActionNone) {
+			next[path] = model.SyncEntry{
+				Path:       path,
+				Hash:       l.Hash,
+				RemoteHash: r.Hash,
+				ModTime:    l.ModTime,
+			}
+		}
+	}
+
+	// 两侧都已不存在的文件不再需要基准
+	for path := range next {
+		if !paths[path] {
+			delete(next, path)
+		}
+	}
+	return next
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/model"
+	"github.com/litongjava/hfile/utils"
+)
+
+func TestExplainAction(t *testing.T) {
+	meta := func(hash string, modTime int64) *model.FileMeta {
+		return &model.FileMeta{Path: "a.txt", Hash: hash, ModTime: modTime}
+	}
+	base := &model.SyncEntry{Path: "a.txt", Hash: "h1", RemoteHash: "h1", ModTime: 100}
+
+	tests := []struct {
+		name       string
+		local      *model.FileMeta
+		remote     *model.FileMeta
+		base       *model.SyncEntry
+		wantAction SyncAction
+		wantReason string
+	}{
+		// 只有基准或都不存在
+		{name: "nothing anywhere", wantAction: ActionNone},
+		{name: "deleted on both sides", base: base, wantAction: ActionNone},
+
+		// 只有本地
+		{name: "new local file", local: meta("h1", 100), wantAction: ActionUpload, wantReason: "new local file"},
+		{name: "deleted remotely", local: meta("h1", 100), base: base, wantAction: ActionDeleteLocal, wantReason: "deleted remotely"},
+		{
+			name:  "modified locally, deleted remotely",
+			local: meta("h2", 200), base: base,
+			wantAction: ActionUpload, wantReason: "modified locally, deleted remotely",
+		},
+
+		// 只有远程
+		{name: "new remote file", remote: meta("h1", 100), wantAction: ActionDownload, wantReason: "new remote file"},
+		{name: "deleted locally", remote: meta("h1", 100), base: base, wantAction: ActionDeleteRemote, wantReason: "deleted locally"},
+		{
+			name:   "modified remotely, deleted locally",
+			remote: meta("h2", 200), base: base,
+			wantAction: ActionDownload, wantReason: "modified remotely, deleted locally",
+		},
+
+		// 两侧都存在，没有基准
+		{name: "same content, no base", local: meta("h1", 100), remote: meta("h1", 200), wantAction: ActionNone},
+		{
+			name:  "different content, no base",
+			local: meta("h1", 200), remote: meta("h2", 100),
+			wantAction: ActionConflict, wantReason: "differs, no previous sync",
+		},
+		{
+			name:  "no local hash, local newer",
+			local: meta("", 200), remote: meta("h2", 100),
+			wantAction: ActionUpload, wantReason: "local is newer",
+		},
+		{
+			name:  "no remote hash, remote newer",
+			local: meta("h1", 100), remote: meta("", 200),
+			wantAction: ActionDownload, wantReason: "remote is newer",
+		},
+		{name: "no hash, same mod time", local: meta("", 100), remote: meta("h2", 100), wantAction: ActionNone},
+
+		// 两侧都存在，有基准
+		{name: "unchanged", local: meta("h1", 100), remote: meta("h1", 100), base: base, wantAction: ActionNone},
+		{
+			name:  "modified locally",
+			local: meta("h2", 200), remote: meta("h1", 100), base: base,
+			wantAction: ActionUpload, wantReason: "modified locally",
+		},
+		{
+			name:  "modified remotely",
+			local: meta("h1", 100), remote: meta("h2", 50), base: base,
+			wantAction: ActionDownload, wantReason: "modified remotely",
+		},
+		{
+			name:  "same change on both sides",
+			local: meta("h2", 200), remote: meta("h2", 300), base: base,
+			wantAction: ActionNone,
+		},
+		{
+			name:  "modified locally and remotely",
+			local: meta("h2", 200), remote: meta("h3", 300), base: base,
+			wantAction: ActionConflict, wantReason: "modified locally and remotely",
+		},
+		{
+			// 远程一侧与基准中的 RemoteHash 比较，而不是本地哈希
+			name:  "remote compared with the remote hash of the base",
+			local: meta("h1", 100), remote: meta("r1", 100),
+			base:       &model.SyncEntry{Path: "a.txt", Hash: "h1", RemoteHash: "r1"},
+			wantAction: ActionNone,
+		},
+		{
+			// 修改时间只在缺少基准和哈希时使用
+			name:  "mod time ignored with a base",
+			local: meta("h1", 999), remote: meta("h1", 1), base: base,
+			wantAction: ActionNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, reason := ExplainAction(tt.local, tt.remote, tt.base)
+			if action != tt.wantAction || reason != tt.wantReason {
+				t.Errorf("ExplainAction = %v, %q, want %v, %q", action, reason, tt.wantAction, tt.wantReason)
+			}
+			if got := DecideAction(tt.local, tt.remote, tt.base); got != action {
+				t.Errorf("DecideAction = %v, ExplainAction = %v", got, action)
+			}
+		})
+	}
+}
+
+func TestBuildSyncState(t *testing.T) {
+	entry := func(path, hash, remoteHash string) model.SyncEntry {
+		return model.SyncEntry{Path: path, Hash: hash, RemoteHash: remoteHash, ModTime: 100}
+	}
+	files := func(pairs ...string) map[string]model.FileMeta {
+		result := make(map[string]model.FileMeta)
+		for i := 0; i < len(pairs); i += 2 {
+			result[pairs[i]] = model.FileMeta{Path: pairs[i], Hash: pairs[i+1], ModTime: 100}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		base   map[string]model.SyncEntry
+		local  map[string]model.FileMeta
+		remote map[string]model.FileMeta
+		done   map[string]bool
+		want   map[string]model.SyncEntry
+	}{
+		{
+			name:   "uploaded file records both sides",
+			base:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+			local:  files("a", "h2"),
+			remote: files("a", "h2"),
+			done:   map[string]bool{"a": true},
+			want:   map[string]model.SyncEntry{"a": entry("a", "h2", "h2")},
+		},
+		{
+			name:   "done file records the remote hash separately",
+			local:  files("a", "h2"),
+			remote: files("a", "r2"),
+			done:   map[string]bool{"a": true},
+			want:   map[string]model.SyncEntry{"a": entry("a", "h2", "r2")},
+		},
+		{
+			name:   "files already in sync are recorded",
+			local:  files("a", "h1"),
+			remote: files("a", "h1"),
+			want:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+		},
+		{
+			name:   "pending change keeps the old base",
+			base:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+			local:  files("a", "h2"),
+			remote: files("a", "h1"),
+			want:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+		},
+		{
+			name:   "unresolved conflict keeps the old base",
+			base:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+			local:  files("a", "h2"),
+			remote: files("a", "h3"),
+			want:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+		},
+		{
+			name:   "pending change without a base is not recorded",
+			local:  files("a", "h1"),
+			remote: files("a", "h2"),
+			want:   map[string]model.SyncEntry{},
+		},
+		{
+			name:  "file only on one side keeps the old base",
+			base:  map[string]model.SyncEntry{"a": entry("a", "h1", "h1"), "b": entry("b", "h1", "h1")},
+			local: files("a", "h2"),
+			// b 只在远程，等待下一次同步删除远程或重新下载
+			remote: files("b", "h1"),
+			want:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1"), "b": entry("b", "h1", "h1")},
+		},
+		{
+			name:   "file deleted on both sides is dropped",
+			base:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1"), "gone": entry("gone", "h1", "h1")},
+			local:  files("a", "h1"),
+			remote: files("a", "h1"),
+			want:   map[string]model.SyncEntry{"a": entry("a", "h1", "h1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := maps.Clone(tt.base)
+			got := BuildSyncState(tt.base, tt.local, tt.remote, tt.done)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("BuildSyncState =\n%v\nwant\n%v", got, tt.want)
+			}
+			if !maps.Equal(tt.base, before) {
+				t.Errorf("base modified: %v, was %v", tt.base, before)
+			}
+		})
+	}
+}
+
+func TestConflictCopyPath(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "a.txt", want: "a.txt.conflict-laptop-20240102-030405"},
+		{path: "docs/a.txt", want: "docs/a.txt.conflict-laptop-20240102-030405"},
+		{path: "docs/archive.tar.gz", want: "docs/archive.tar.gz.conflict-laptop-20240102-030405"},
+	}
+	for _, tt := range tests {
+		if got := ConflictCopyPath(tt.path, "laptop", now); got != tt.want {
+			t.Errorf("ConflictCopyPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindConflictCopy(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"docs/a.txt": "local",
+		"docs/a.txt.conflict-laptop-20240101-000000": "remote v1",
+		"docs/a.txt.conflict-laptop-20240102-000000": "remote v2",
+		// 名字以 a.txt 开头但属于其它文件的冲突副本
+		"docs/a.txt2.conflict-laptop-20240101-000000": "remote v3",
+		"b.txt.conflict-desktop-20240101-000000":      "remote b",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "docs", "a.txt.conflict-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hashOf := func(name string) string {
+		hash, err := utils.HashFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		hash   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name: "copy with the same content", path: "docs/a.txt",
+			hash: hashOf("docs/a.txt.conflict-laptop-20240102-000000"),
+			want: "docs/a.txt.conflict-laptop-20240102-000000", wantOK: true,
+		},
+		{
+			name: "hash compared case-insensitively", path: "docs/a.txt",
+			hash: strings.ToUpper(hashOf("docs/a.txt.conflict-laptop-20240101-000000")),
+			want: "docs/a.txt.conflict-laptop-20240101-000000", wantOK: true,
+		},
+		{
+			name: "copy at the repository root", path: "b.txt",
+			hash: hashOf("b.txt.conflict-desktop-20240101-000000"),
+			want: "b.txt.conflict-desktop-20240101-000000", wantOK: true,
+		},
+		{name: "no copy with this content", path: "docs/a.txt", hash: hashOf("docs/a.txt")},
+		{name: "copy of another file", path: "docs/a.txt", hash: hashOf("docs/a.txt2.conflict-laptop-20240101-000000")},
+		{name: "unknown hash", path: "docs/a.txt"},
+		{name: "missing directory", path: "missing/a.txt", hash: hashOf("docs/a.txt")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FindConflictCopy(root, tt.path, tt.hash)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("FindConflictCopy(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
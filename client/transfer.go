@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultJobs 默认的并发传输数
+const DefaultJobs = 4
+
+// TransferKind 传输任务的类型
+type TransferKind string
+
+const (
+	TransferUpload       TransferKind = "upload"
+	TransferDownload     TransferKind = "download"
+	TransferDeleteRemote TransferKind = "delete-remote"
+	TransferDeleteLocal  TransferKind = "delete-local"
+)
+
+// TransferTask 是一个待执行的文件传输，Run 应在 ctx 取消后尽快返回
+type TransferTask struct {
+	Kind TransferKind
+	Path string
+	Run  func(ctx context.Context) error
+}
+
+type transferTaskKey struct{}
+
+// TransferTaskFromContext 返回 ctx 所属的传输任务。TransferScheduler 把任务放在传给 Run 的 ctx 中，
+// Client.OnRetry 可以借此知道重试属于哪个文件。
+func TransferTaskFromContext(ctx context.Context) (TransferTask, bool) {
+	task, ok := ctx.Value(transferTaskKey{}).(TransferTask)
+	return task, ok
+}
+
+// TransferResult 是单个任务的执行结果
+type TransferResult struct {
+	Task TransferTask
+	Err  error
+	// Cancelled 表示任务因 ctx 取消而中断，Err 为中断时的错误
+	Cancelled bool
+}
+
+// TransferSummary 汇总一次调度中所有任务的结果
+type TransferSummary struct {
+	Succeeded []TransferResult
+	Failed    []TransferResult
+	// Cancelled 是 ctx 取消时正在执行而被中断的任务
+	Cancelled []TransferResult
+	// Skipped 是 ctx 取消后没有开始的任务
+	Skipped []TransferTask
+}
+
+// Interrupted 判断调度是否因 ctx 取消而提前结束
+func (s TransferSummary) Interrupted() bool {
+	return len(s.Cancelled) > 0 || len(s.Skipped) > 0
+}
+
+// TransferScheduler 以固定数量的 worker 并发执行传输任务。
+// OnStart 和 OnDone 在同一把锁内串行调用，可以直接输出而不会交错。
+type TransferScheduler struct {
+	Jobs    int
+	OnStart func(task TransferTask)
+	OnDone  func(result TransferResult)
+}
+
+// Run 执行所有任务并在全部结束后返回汇总结果。
+// ctx 取消后不再启动新任务，正在执行的任务收到同一个 ctx，由任务自己决定如何停止。
+func (s *TransferScheduler) Run(ctx context.Context, tasks []TransferTask) TransferSummary {
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = DefaultJobs
+	}
+	if jobs > len(tasks) {
+		jobs = len(tasks)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		summary TransferSummary
+	)
+	queue := make(chan TransferTask)
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				mu.Lock()
+				if s.OnStart != nil {
+					s.OnStart(task)
+				}
+				mu.Unlock()
+
+				taskCtx := context.WithValue(ctx, transferTaskKey{}, task)
+				result := TransferResult{Task: task, Err: task.Run(taskCtx)}
+
+				mu.Lock()
+				result.Cancelled = result.Err != nil && ctx.Err() != nil
+				if result.Cancelled {
+					summary.Cancelled = append(summary.Cancelled, result)
+				} else if result.Err != nil {
+					summary.Failed = append(summary.Failed, result)
+				} else {
+					summary.Succeeded = append(summary.Succeeded, result)
+				}
+				if s.OnDone != nil {
+					s.OnDone(result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var skipped []TransferTask
+dispatch:
+	for i, task := range tasks {
+		if ctx.Err() != nil {
+			skipped = tasks[i:]
+			break
+		}
+		select {
+		case queue <- task:
+		case <-ctx.Done():
+			skipped = tasks[i:]
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	summary.Skipped = skipped
+	return summary
+}
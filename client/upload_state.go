@@ -0,0 +1,108 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/litongjava/hfile/model"
+)
+
+// uploadState 记录一次未完成的分片上传，保存在 .hfile/uploads/ 下，用于中断后续传
+type uploadState struct {
+	UploadID   string                `json:"upload_id"`
+	Server     string                `json:"server"`
+	Repo       string                `json:"repo"`
+	RemotePath string                `json:"remote_path"`
+	Size       int64                 `json:"size"`
+	ModTimeNs  int64                 `json:"mod_time_ns"`
+	Hash       string                `json:"hash"`
+	ChunkSize  int64                 `json:"chunk_size"`
+	TotalParts int                   `json:"total_parts"`
+	Parts      []model.CompletedPart `json:"parts"`
+
+	path string
+}
+
+// uploadStatePath 返回上传状态文件的路径，repoRoot 为空时不保存状态。
+// upload_id 只在签发它的服务器上有效，所以路径同时由服务器地址、仓库和远程路径决定。
+func uploadStatePath(repoRoot, serverURL, repo, remotePath string) string {
+	if repoRoot == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(serverURL + "\x00" + repo + "\x00" + remotePath))
+	return filepath.Join(repoRoot, ".hfile", "uploads", hex.EncodeToString(sum[:16])+".json")
+}
+
+// loadUploadState 读取上传状态，文件不存在时返回 nil。
+// 无法解析的状态文件会被删除，同时返回 nil 和解析错误。
+func loadUploadState(statePath string) (*uploadState, error) {
+	if statePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, nil
+	}
+	var state uploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		os.Remove(statePath)
+		return nil, err
+	}
+	state.path = statePath
+	return &state, nil
+}
+
+// matches 判断状态是否属于同一个未修改的文件
+func (s *uploadState) matches(size, modTimeNs int64, hash string, chunkSize int64) bool {
+	return s.Size == size && s.ModTimeNs == modTimeNs && s.Hash == hash && s.ChunkSize == chunkSize
+}
+
+// acked 返回已确认分片的集合
+func (s *uploadState) acked() map[int]bool {
+	result := make(map[int]bool, len(s.Parts))
+	for _, part := range s.Parts {
+		result[part.PartIndex] = true
+	}
+	return result
+}
+
+// markAcked 记录一个已被服务器确认的分片并立即落盘，并发调用需由调用方加锁
+func (s *uploadState) markAcked(part model.CompletedPart) error {
+	for i, existing := range s.Parts {
+		if existing.PartIndex == part.PartIndex {
+			s.Parts[i] = part
+			return s.save()
+		}
+	}
+	s.Parts = append(s.Parts, part)
+	sort.Slice(s.Parts, func(i, j int) bool { return s.Parts[i].PartIndex < s.Parts[j].PartIndex })
+	return s.save()
+}
+
+func (s *uploadState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *uploadState) remove() {
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/litongjava/hfile/client/clienttest"
+	"github.com/litongjava/hfile/utils"
+)
+
+func TestUploadStateIsPerServer(t *testing.T) {
+	a := clienttest.NewServer()
+	defer a.Close()
+	b := clienttest.NewServer()
+	defer b.Close()
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".hfile"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(root, "a.bin")
+	if err := os.WriteFile(localPath, []byte("0123456789ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(srv *clienttest.Server) *Client {
+		c := New(srv.URL, StaticToken(srv.Token()))
+		c.Retry = RetryPolicy{MaxAttempts: 1}
+		c.Chunks = ChunkOptions{Size: 4, Jobs: 1}
+		return c
+	}
+
+	// 在 A 上中断的上传留下状态文件
+	a.Inject(clienttest.Fault{Path: "/file/upload/chunk", Kind: clienttest.FaultStatus, Status: 500})
+	if err := newClient(a).UploadInChunks(context.Background(), "demo", localPath, "a.bin", ""); err == nil {
+		t.Fatal("upload to A succeeded, want the injected chunk failure")
+	}
+	statePath := uploadStatePath(root, a.URL, "demo", "a.bin")
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("upload state for A not saved: %v", err)
+	}
+
+	// 同一个文件上传到 B 不能拿 A 的 upload_id 去续传，也不能删掉 A 的状态
+	if err := newClient(b).UploadInChunks(context.Background(), "demo", localPath, "a.bin", ""); err != nil {
+		t.Fatalf("upload to B: %v", err)
+	}
+	if n := b.CountRequests("GET /file/upload/status"); n != 0 {
+		t.Errorf("B received %d upload status queries, want 0", n)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Errorf("upload state for A removed by the upload to B: %v", err)
+	}
+
+	// 回到 A 时继续之前的上传
+	a.ClearFaults()
+	if err := newClient(a).UploadInChunks(context.Background(), "demo", localPath, "a.bin", ""); err != nil {
+		t.Fatalf("resume upload to A: %v", err)
+	}
+	if n := a.CountRequests("POST /file/upload/init"); n != 1 {
+		t.Errorf("A received %d upload inits, want the upload to be resumed", n)
+	}
+	if f, ok := a.File("demo", "a.bin"); !ok || string(f.Content) != "0123456789ab" {
+		t.Errorf("a.bin on A = %q, %v", f.Content, ok)
+	}
+}
+
+func TestUploadStateFromAnotherServerIsRejected(t *testing.T) {
+	srv := clienttest.NewServer()
+	defer srv.Close()
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".hfile"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(root, "a.bin")
+	if err := os.WriteFile(localPath, []byte("0123456789ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := utils.HashFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 状态文件位于本服务器的路径下，但记录的是另一个服务器签发的 upload_id
+	statePath := uploadStatePath(root, srv.URL, "demo", "a.bin")
+	state, _ := json.Marshal(uploadState{
+		UploadID: "foreign", Server: "http://other.example", Repo: "demo", RemotePath: "a.bin",
+		Size: info.Size(), ModTimeNs: info.ModTime().UnixNano(), Hash: hash, ChunkSize: 4, TotalParts: 3,
+	})
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath, state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(srv.URL, StaticToken(srv.Token()))
+	c.Retry = RetryPolicy{MaxAttempts: 1}
+	c.Chunks = ChunkOptions{Size: 4, Jobs: 1}
+	if err := c.UploadInChunks(context.Background(), "demo", localPath, "a.bin", ""); err != nil {
+		t.Fatalf("UploadInChunks: %v", err)
+	}
+	if n := srv.CountRequests("GET /file/upload/status"); n != 0 {
+		t.Errorf("server received %d upload status queries for a foreign upload, want 0", n)
+	}
+	if n := srv.CountRequests("POST /file/upload/init"); n != 1 {
+		t.Errorf("server received %d upload inits, want 1", n)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/litongjava/hfile/cli"
+	"github.com/litongjava/hfile/client"
+	"github.com/litongjava/hfile/config"
+	constant "github.com/litongjava/hfile/const"
+	"github.com/litongjava/hfile/server"
+	"github.com/litongjava/hfile/utils"
+)
+
+// globalOptions 是所有命令共用的参数
+type globalOptions struct {
+	repoDir string
+	server  string
+	profile string
+	verbose bool
+	output  string
+}
+
+var globals globalOptions
+
+func registerGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&globals.repoDir, "repo-dir", ".", "repository `dir`")
+	fs.StringVar(&globals.server, "server", "", "server `url`, overrides config files")
+	fs.StringVar(&globals.profile, "profile", "", "config profile `name`, overrides $"+config.EnvProfile)
+	fs.BoolVar(&globals.verbose, "verbose", false, "print debug logs")
+	fs.StringVar(&globals.output, "output", outputText, "output `format`: text, json or ndjson")
+	fs.BoolFunc("json", "shorthand for --output json", func(string) error {
+		globals.output = outputJSON
+		return nil
+	})
+}
+
+// loadServerURL 返回服务器地址：--server 参数 > --profile 参数 > 环境变量 > 仓库配置 > 用户主目录配置 > 默认值
+func loadServerURL(repoDir string) (string, error) {
+	if globals.server != "" {
+		return globals.server, nil
+	}
+	return config.LoadConfig(repoDir)
+}
+
+// registerSyncFlags 注册 push/pull/status 共用的参数
+func registerSyncFlags(fs *flag.FlagSet, opts *syncOptions, transfer bool) {
+	fs.BoolVar(&opts.rehash, "rehash", false, "ignore .hfile/index and rehash every file")
+	if !transfer {
+		return
+	}
+	fs.IntVar(&opts.jobs, "jobs", 0, "number of concurrent transfers (default from config or 4)")
+	fs.BoolFunc("force-local", "resolve conflicts with the local version", func(string) error {
+		opts.strategy = client.ConflictForceLocal
+		return nil
+	})
+	fs.BoolFunc("force-remote", "resolve conflicts with the remote version", func(string) error {
+		opts.strategy = client.ConflictForceRemote
+		return nil
+	})
+}
+
+// configScope 选择 config get/set/unset 操作的配置文件
+type configScope string
+
+const (
+	scopeAny    configScope = ""
+	scopeGlobal configScope = "global"
+	scopeLocal  configScope = "local"
+)
+
+// registerScopeFlags 注册 --global/--local 参数
+func registerScopeFlags(fs *flag.FlagSet, scope *configScope) {
+	set := func(s configScope) func(string) error {
+		return func(string) error {
+			if *scope != scopeAny && *scope != s {
+				return fmt.Errorf("--global and --local cannot be used together")
+			}
+			*scope = s
+			return nil
+		}
+	}
+	fs.BoolFunc("global", "use ~/.hfile/config.toml", set(scopeGlobal))
+	fs.BoolFunc("local", "use the repository .hfile/config.toml", set(scopeLocal))
+}
+
+// withGlobals 在命令执行前应用全局参数，并按输出格式报告命令返回的错误
+func withGlobals(run func(ctx *cli.Context) error) func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		switch globals.output {
+		case outputText, outputJSON, outputNDJSON:
+		default:
+			return &cli.UsageError{Command: ctx.Command, Msg: fmt.Sprintf("invalid --output value: %s", globals.output)}
+		}
+		if globals.verbose {
+			hlog.SetLevel(hlog.LevelDebug)
+		} else {
+			hlog.SetLevel(hlog.LevelWarn)
+		}
+		// 在仓库的子目录中运行时，配置、仓库名和同步状态都从仓库根目录读取。
+		// init-local 在 --repo-dir 创建新的仓库，不向上查找。
+		if ctx.Command.Path() != "hfile init-local" {
+			if root, err := utils.GetRepoRoot(globals.repoDir); err == nil {
+				globals.repoDir = root
+			}
+		}
+		// 旧版本把 token 写在 config.toml 中，先移到 credentials.toml
+		if err := config.MigrateLegacyTokens(globals.repoDir); err != nil {
+			warn(err)
+		}
+		profile, err := config.ResolveProfile(globals.repoDir, globals.profile)
+		if err != nil {
+			// config 命令需要在 profile 配置错误时仍然可用，以便修复配置
+			if !strings.HasPrefix(ctx.Command.Path(), "hfile config ") {
+				return reportError(fmt.Errorf("Failed: %w", err))
+			}
+			warn(err)
+		}
+		config.SetActiveProfile(profile, globals.profile != "")
+		return reportError(run(ctx))
+	}
+}
+
+func newApp() *cli.App {
+	var opts syncOptions
+	var logoutAll bool
+	var scope configScope
+	var repoName string
+	var localOnly bool
+	var serveOpts server.Options
+
+	app := &cli.App{
+		Name:        "hfile",
+		Summary:     "hfile - sync a directory with an hfile server",
+		Footer:      fmt.Sprintf("默认服务器地址: %s", constant.ServerURL),
+		GlobalFlags: registerGlobalFlags,
+		Commands: []*cli.Command{
+			{
+				Name:    "init",
+				Usage:   "[server_url]",
+				Summary: "初始化用户主目录配置文件",
+				MaxArgs: 1,
+				Run: func(ctx *cli.Context) error {
+					return handleInit(ctx.Arg(0))
+				},
+			},
+			{
+				Name:    "init-local",
+				Usage:   "[server_url]",
+				Summary: "初始化当前目录配置文件",
+				MaxArgs: 1,
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(&repoName, "repo", "", "remote repository `name` (default: directory name)")
+				},
+				Run: func(ctx *cli.Context) error {
+					return handleInitLocal(globals.repoDir, ctx.Arg(0), repoName)
+				},
+			},
+			{
+				Name:    "config",
+				Summary: "管理配置",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Summary: "显示所有配置信息",
+						Run: func(ctx *cli.Context) error {
+							return handleConfigList(globals.repoDir)
+						},
+					},
+					{
+						Name:    "get",
+						Usage:   "<key>",
+						Summary: "显示配置项的值",
+						MinArgs: 1,
+						MaxArgs: 1,
+						Flags:   func(fs *flag.FlagSet) { registerScopeFlags(fs, &scope) },
+						Run: func(ctx *cli.Context) error {
+							return handleConfigGet(globals.repoDir, ctx.Arg(0), scope)
+						},
+					},
+					{
+						Name:    "set",
+						Usage:   "<key> <value>",
+						Summary: "设置配置项，默认写入当前仓库",
+						MinArgs: 2,
+						MaxArgs: 2,
+						Flags:   func(fs *flag.FlagSet) { registerScopeFlags(fs, &scope) },
+						Run: func(ctx *cli.Context) error {
+							return handleConfigSet(globals.repoDir, ctx.Arg(0), ctx.Arg(1), scope)
+						},
+					},
+					{
+						Name:    "unset",
+						Usage:   "<key>",
+						Summary: "删除配置项，默认从当前仓库删除",
+						MinArgs: 1,
+						MaxArgs: 1,
+						Flags:   func(fs *flag.FlagSet) { registerScopeFlags(fs, &scope) },
+						Run: func(ctx *cli.Context) error {
+							return handleConfigUnset(globals.repoDir, ctx.Arg(0), scope)
+						},
+					},
+					{
+						Name:    "use",
+						Usage:   "<profile>",
+						Summary: "设置当前仓库默认使用的 profile",
+						MinArgs: 1,
+						MaxArgs: 1,
+						Run: func(ctx *cli.Context) error {
+							return handleConfigUse(globals.repoDir, ctx.Arg(0))
+						},
+					},
+				},
+			},
+			{
+				Name:    "repo",
+				Summary: "管理远程仓库",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Summary: "show all repository",
+						Run: func(ctx *cli.Context) error {
+							return handleListRepos(globals.repoDir)
+						},
+					},
+				},
+			},
+			{
+				Name:    "remote",
+				Summary: "管理仓库对应的远程仓库",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "rename",
+						Usage:   "<new_name>",
+						Summary: "重命名远程仓库并更新仓库配置",
+						MinArgs: 1,
+						MaxArgs: 1,
+						Flags: func(fs *flag.FlagSet) {
+							fs.BoolVar(&localOnly, "local", false, "only point this repository at another remote repository")
+						},
+						Run: func(ctx *cli.Context) error {
+							return handleRemoteRename(globals.repoDir, ctx.Arg(0), localOnly)
+						},
+					},
+				},
+			},
+			{
+				Name:    "register",
+				Usage:   "<email> <password>",
+				Summary: "注册用户",
+				MinArgs: 2,
+				MaxArgs: 2,
+				Run: func(ctx *cli.Context) error {
+					return handleRegister(globals.repoDir, ctx.Arg(0), ctx.Arg(1))
+				},
+			},
+			{
+				Name:    "login",
+				Usage:   "<email> <password>",
+				Summary: "用户登录",
+				MinArgs: 2,
+				MaxArgs: 2,
+				Run: func(ctx *cli.Context) error {
+					return handleLogin(globals.repoDir, ctx.Arg(0), ctx.Arg(1))
+				},
+			},
+			{
+				Name:    "profile",
+				Summary: "显示当前用户信息",
+				Run: func(ctx *cli.Context) error {
+					return handleProfile(globals.repoDir)
+				},
+			},
+			{
+				Name:    "logout",
+				Summary: "注销登录并清除保存的 token",
+				Flags: func(fs *flag.FlagSet) {
+					fs.BoolVar(&logoutAll, "all", false, "log out from every server with a saved token")
+				},
+				Run: func(ctx *cli.Context) error {
+					return handleLogout(globals.repoDir, logoutAll)
+				},
+			},
+			{
+				Name:    "whoami",
+				Summary: "显示当前服务器、账号和 token 来源",
+				Run: func(ctx *cli.Context) error {
+					return handleWhoami(globals.repoDir)
+				},
+			},
+			{
+				Name:    "token",
+				Summary: "管理登录凭证",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "refresh",
+						Summary: "使用 refresh_token 换取新的 token",
+						Run: func(ctx *cli.Context) error {
+							return handleTokenRefresh(globals.repoDir)
+						},
+					},
+				},
+			},
+			{
+				Name:    "push",
+				Summary: "推送本地变更到远程",
+				Flags:   func(fs *flag.FlagSet) { registerSyncFlags(fs, &opts, true) },
+				Run: func(ctx *cli.Context) error {
+					if opts.jobs < 0 {
+						return &cli.UsageError{Command: ctx.Command, Msg: "--jobs must be a positive integer"}
+					}
+					return handlePush(globals.repoDir, opts)
+				},
+			},
+			{
+				Name:    "pull",
+				Summary: "拉取远程变更到本地",
+				Flags:   func(fs *flag.FlagSet) { registerSyncFlags(fs, &opts, true) },
+				Run: func(ctx *cli.Context) error {
+					if opts.jobs < 0 {
+						return &cli.UsageError{Command: ctx.Command, Msg: "--jobs must be a positive integer"}
+					}
+					return handlePull(globals.repoDir, opts)
+				},
+			},
+			{
+				Name:    "clone",
+				Usage:   "<repo> [dir]",
+				Summary: "从远程仓库创建本地仓库",
+				MinArgs: 1,
+				MaxArgs: 2,
+				Flags: func(fs *flag.FlagSet) {
+					fs.IntVar(&opts.jobs, "jobs", 0, "number of concurrent transfers (default from config or 4)")
+				},
+				Run: func(ctx *cli.Context) error {
+					if opts.jobs < 0 {
+						return &cli.UsageError{Command: ctx.Command, Msg: "--jobs must be a positive integer"}
+					}
+					return handleClone(ctx.Arg(0), ctx.Arg(1), opts)
+				},
+			},
+			{
+				Name:    "status",
+				Summary: "显示待上传/下载的文件",
+				Flags:   func(fs *flag.FlagSet) { registerSyncFlags(fs, &opts, false) },
+				Run: func(ctx *cli.Context) error {
+					return handleStatus(globals.repoDir, opts)
+				},
+			},
+			{
+				Name:    "check-ignore",
+				Usage:   "<path>",
+				Summary: "显示路径匹配的忽略规则",
+				MinArgs: 1,
+				MaxArgs: 1,
+				Run: func(ctx *cli.Context) error {
+					return handleCheckIgnore(ctx.Arg(0))
+				},
+			},
+			{
+				Name:    "serve",
+				Summary: "启动 hfile 服务器",
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(&serveOpts.Addr, "addr", server.DefaultAddr, "listen `address`")
+					fs.StringVar(&serveOpts.DataDir, "data-dir", server.DefaultDataDir, "`dir` holding file contents and metadata")
+					fs.DurationVar(&serveOpts.TokenTTL, "token-ttl", server.DefaultTokenTTL, "lifetime of access tokens")
+					fs.DurationVar(&serveOpts.RefreshTTL, "refresh-ttl", server.DefaultRefreshTTL, "lifetime of refresh tokens")
+					fs.DurationVar(&serveOpts.UploadTTL, "upload-ttl", server.DefaultUploadTTL, "how long unfinished chunked uploads are kept after their last chunk")
+				},
+				Run: func(ctx *cli.Context) error {
+					return handleServe(serveOpts)
+				},
+			},
+		},
+	}
+
+	for _, cmd := range app.Commands {
+		wrapRun(cmd)
+	}
+	return app
+}
+
+func wrapRun(cmd *cli.Command) {
+	if cmd.Run != nil {
+		cmd.Run = withGlobals(cmd.Run)
+	}
+	for _, sub := range cmd.Subcommands {
+		wrapRun(sub)
+	}
+}
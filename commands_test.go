@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/litongjava/hfile/cli"
+	"github.com/litongjava/hfile/config"
+)
+
+// isolateConfig 让用户主目录指向临时目录并清空 HFILE_* 环境变量，测试不读取真实的配置和凭证
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	for _, env := range []string{config.EnvServer, config.EnvProfile, config.EnvToken, config.EnvRefreshToken, config.EnvRepo,
+		config.EnvJobs, config.EnvChunkSize, config.EnvChunkJobs,
+		config.EnvRetryAttempts, config.EnvRetryBaseDelay, config.EnvRetryMaxDelay, config.EnvRetryJitter} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestParseCommands(t *testing.T) {
+	defaults := globalOptions{repoDir: ".", output: outputText}
+
+	tests := []struct {
+		name string
+		args []string
+
+		// 期望的命令、位置参数、命令行中出现过的参数（名称 -> 值）和全局参数
+		command string
+		posArgs []string
+		flags   map[string]string
+		globals globalOptions
+
+		// 期望的 UsageError 信息，为空表示期望解析成功
+		usageErr string
+	}{
+		{name: "init", args: []string{"init"}, command: "hfile init"},
+		{name: "init with server", args: []string{"init", "http://x"}, command: "hfile init", posArgs: []string{"http://x"}},
+		{name: "init with two servers", args: []string{"init", "http://x", "http://y"}, usageErr: "unexpected argument: http://y"},
+		{
+			name:    "init-local",
+			args:    []string{"init-local", "http://x", "--repo", "demo", "--repo-dir", "work"},
+			command: "hfile init-local",
+			posArgs: []string{"http://x"},
+			flags:   map[string]string{"repo": "demo", "repo-dir": "work"},
+			globals: globalOptions{repoDir: "work"},
+		},
+
+		{name: "config list", args: []string{"config", "list"}, command: "hfile config list"},
+		{
+			name:    "config list with repo dir before the command",
+			args:    []string{"--repo-dir", "work", "config", "list"},
+			command: "hfile config list",
+			flags:   map[string]string{"repo-dir": "work"},
+			globals: globalOptions{repoDir: "work"},
+		},
+		{
+			name:    "config list with repo dir after the command",
+			args:    []string{"config", "list", "--repo-dir", "work"},
+			command: "hfile config list",
+			flags:   map[string]string{"repo-dir": "work"},
+			globals: globalOptions{repoDir: "work"},
+		},
+		{name: "config list with an argument", args: []string{"config", "list", "server"}, usageErr: "unexpected argument: server"},
+		{
+			name:    "config get",
+			args:    []string{"config", "get", "server", "--global"},
+			command: "hfile config get",
+			posArgs: []string{"server"},
+			flags:   map[string]string{"global": ""},
+		},
+		{
+			name:     "config get with both scopes",
+			args:     []string{"config", "get", "server", "--global", "--local"},
+			usageErr: "invalid boolean flag local: --global and --local cannot be used together",
+		},
+		{name: "config get without key", args: []string{"config", "get"}, usageErr: "missing arguments"},
+		{
+			name:    "config set",
+			args:    []string{"config", "set", "--local", "jobs", "4"},
+			command: "hfile config set",
+			posArgs: []string{"jobs", "4"},
+			flags:   map[string]string{"local": ""},
+		},
+		{name: "config set without value", args: []string{"config", "set", "jobs"}, usageErr: "missing arguments"},
+		{name: "config unset", args: []string{"config", "unset", "jobs"}, command: "hfile config unset", posArgs: []string{"jobs"}},
+		{name: "config use", args: []string{"config", "use", "prod"}, command: "hfile config use", posArgs: []string{"prod"}},
+		{name: "config without subcommand", args: []string{"config"}, usageErr: "missing config subcommand"},
+		{name: "config with unknown subcommand", args: []string{"config", "edit"}, usageErr: "invalid config subcommand: edit"},
+
+		{name: "repo list", args: []string{"repo", "list"}, command: "hfile repo list"},
+		{
+			name:    "remote rename",
+			args:    []string{"remote", "rename", "photos"},
+			command: "hfile remote rename",
+			posArgs: []string{"photos"},
+		},
+		{
+			name:    "remote rename local only",
+			args:    []string{"remote", "rename", "--local", "photos"},
+			command: "hfile remote rename",
+			posArgs: []string{"photos"},
+			flags:   map[string]string{"local": "true"},
+		},
+		{name: "remote rename without name", args: []string{"remote", "rename"}, usageErr: "missing arguments"},
+		{name: "remote without subcommand", args: []string{"remote"}, usageErr: "missing remote subcommand"},
+
+		{name: "register", args: []string{"register", "a@b.c", "secret"}, command: "hfile register", posArgs: []string{"a@b.c", "secret"}},
+		{name: "login", args: []string{"login", "a@b.c", "secret"}, command: "hfile login", posArgs: []string{"a@b.c", "secret"}},
+		{
+			name:    "login with server between arguments",
+			args:    []string{"login", "a@b.c", "--server", "http://x", "secret"},
+			command: "hfile login",
+			posArgs: []string{"a@b.c", "secret"},
+			flags:   map[string]string{"server": "http://x"},
+			globals: globalOptions{server: "http://x"},
+		},
+		{
+			name:    "login with a password starting with a dash",
+			args:    []string{"login", "a@b.c", "--", "-secret"},
+			command: "hfile login",
+			posArgs: []string{"a@b.c", "-secret"},
+		},
+		{name: "login without password", args: []string{"login", "a@b.c"}, usageErr: "missing arguments"},
+		{name: "login with too many arguments", args: []string{"login", "a", "b", "c"}, usageErr: "unexpected argument: c"},
+		{name: "profile", args: []string{"profile"}, command: "hfile profile"},
+		{name: "logout", args: []string{"logout"}, command: "hfile logout"},
+		{name: "logout all", args: []string{"logout", "--all"}, command: "hfile logout", flags: map[string]string{"all": "true"}},
+		{name: "logout with an argument", args: []string{"logout", "http://x"}, usageErr: "unexpected argument: http://x"},
+		{
+			name:    "whoami with profile",
+			args:    []string{"--profile", "prod", "whoami"},
+			command: "hfile whoami",
+			flags:   map[string]string{"profile": "prod"},
+			globals: globalOptions{profile: "prod"},
+		},
+		{name: "token refresh", args: []string{"token", "refresh"}, command: "hfile token refresh"},
+		{name: "token without subcommand", args: []string{"token"}, usageErr: "missing token subcommand"},
+
+		{
+			name:    "push",
+			args:    []string{"push", "--jobs", "8", "--force-local", "--rehash"},
+			command: "hfile push",
+			flags:   map[string]string{"jobs": "8", "force-local": "", "rehash": "true"},
+		},
+		{
+			name:    "pull",
+			args:    []string{"--json", "pull", "--force-remote"},
+			command: "hfile pull",
+			flags:   map[string]string{"json": "", "force-remote": ""},
+			globals: globalOptions{output: outputJSON},
+		},
+		{name: "push with invalid jobs", args: []string{"push", "--jobs", "x"}, usageErr: `invalid value "x" for flag -jobs: parse error`},
+		{name: "push with an argument", args: []string{"push", "a.txt"}, usageErr: "unexpected argument: a.txt"},
+		{
+			name:    "clone",
+			args:    []string{"clone", "demo", "work", "--jobs", "2"},
+			command: "hfile clone",
+			posArgs: []string{"demo", "work"},
+			flags:   map[string]string{"jobs": "2"},
+		},
+		{name: "clone without repo", args: []string{"clone"}, usageErr: "missing arguments"},
+		{name: "clone with force flag", args: []string{"clone", "demo", "--force-local"}, usageErr: "flag provided but not defined: -force-local"},
+		{
+			name:    "status",
+			args:    []string{"status", "--rehash", "--output", "ndjson"},
+			command: "hfile status",
+			flags:   map[string]string{"rehash": "true", "output": "ndjson"},
+			globals: globalOptions{output: outputNDJSON},
+		},
+		{name: "status with jobs", args: []string{"status", "--jobs", "2"}, usageErr: "flag provided but not defined: -jobs"},
+		{name: "check-ignore", args: []string{"check-ignore", "build/a.o"}, command: "hfile check-ignore", posArgs: []string{"build/a.o"}},
+		{
+			name:    "check-ignore with a path that looks like a flag",
+			args:    []string{"check-ignore", "--", "--jobs"},
+			command: "hfile check-ignore",
+			posArgs: []string{"--jobs"},
+		},
+		{
+			name:    "serve",
+			args:    []string{"serve", "--addr", ":9000", "--upload-ttl", "1h"},
+			command: "hfile serve",
+			flags:   map[string]string{"addr": ":9000", "upload-ttl": "1h0m0s"},
+		},
+		{name: "serve with invalid ttl", args: []string{"serve", "--token-ttl", "soon"}, usageErr: `invalid value "soon" for flag -token-ttl: parse error`},
+
+		{name: "help", args: []string{"help"}},
+		{name: "help for a subcommand", args: []string{"help", "remote", "rename"}},
+		{name: "command help", args: []string{"push", "--help"}},
+		{name: "no command", args: nil, usageErr: "missing command"},
+		{name: "unknown command", args: []string{"sync"}, usageErr: "unknown command: sync"},
+		{name: "command flag before the command", args: []string{"--jobs", "2", "push"}, usageErr: "flag provided but not defined: -jobs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp()
+			app.Stdout = &strings.Builder{}
+			ctx, err := app.Parse(tt.args)
+
+			if tt.usageErr != "" {
+				var usageErr *cli.UsageError
+				if !errors.As(err, &usageErr) || usageErr.Msg != tt.usageErr {
+					t.Fatalf("Parse(%q) error = %v, want UsageError %q", tt.args, err, tt.usageErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.args, err)
+			}
+			if tt.command == "" {
+				if ctx != nil {
+					t.Fatalf("Parse(%q) = %s, want help only", tt.args, ctx.Command.Path())
+				}
+				return
+			}
+			if ctx == nil {
+				t.Fatalf("Parse(%q) returned no command, want %s", tt.args, tt.command)
+			}
+
+			if got := ctx.Command.Path(); got != tt.command {
+				t.Errorf("command = %q, want %q", got, tt.command)
+			}
+			if len(ctx.Args) != 0 || len(tt.posArgs) != 0 {
+				if !reflect.DeepEqual(ctx.Args, tt.posArgs) {
+					t.Errorf("args = %q, want %q", ctx.Args, tt.posArgs)
+				}
+			}
+			flags := map[string]string{}
+			ctx.Flags.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+			if len(flags) != 0 || len(tt.flags) != 0 {
+				if !reflect.DeepEqual(flags, tt.flags) {
+					t.Errorf("flags = %v, want %v", flags, tt.flags)
+				}
+			}
+
+			want := defaults
+			if tt.globals.repoDir != "" {
+				want.repoDir = tt.globals.repoDir
+			}
+			if tt.globals.output != "" {
+				want.output = tt.globals.output
+			}
+			want.server, want.profile = tt.globals.server, tt.globals.profile
+			if globals != want {
+				t.Errorf("globals = %+v, want %+v", globals, want)
+			}
+		})
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	isolateConfig(t)
+	notRepo := t.TempDir()
+
+	tests := []struct {
+		name    string
+		args    []string
+		code    int
+		wantOut string
+	}{
+		{name: "help", args: []string{"help"}, code: cli.ExitOK},
+		{name: "command help", args: []string{"remote", "rename", "-h"}, code: cli.ExitOK, wantOut: "Usage:\n  hfile remote rename"},
+		{name: "unknown command", args: []string{"sync"}, code: cli.ExitUsage, wantOut: "❌ unknown command: sync"},
+		{name: "missing arguments", args: []string{"login", "a@b.c"}, code: cli.ExitUsage, wantOut: "❌ missing arguments"},
+		{name: "invalid output", args: []string{"--output", "xml", "status"}, code: cli.ExitUsage, wantOut: "❌ invalid --output value: xml"},
+		{
+			name: "negative jobs",
+			args: []string{"push", "--jobs", "-1", "--repo-dir", notRepo},
+			code: cli.ExitUsage, wantOut: "❌ --jobs must be a positive integer",
+		},
+		{name: "not a repository", args: []string{"status", "--repo-dir", notRepo}, code: cli.ExitFailure, wantOut: "❌"},
+		{
+			name: "not a repository with json output",
+			args: []string{"--json", "status", "--repo-dir", notRepo},
+			code: cli.ExitFailure, wantOut: `"error":`,
+		},
+		{name: "undefined profile", args: []string{"--profile", "nope", "whoami"}, code: cli.ExitFailure, wantOut: `profile "nope" is not defined`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := runHfile(t, tt.args...)
+			if code != tt.code {
+				t.Errorf("hfile %q exited with %d, want %d:\n%s", tt.args, code, tt.code, out)
+			}
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("output = %q, want it to contain %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestLegacyTokenMigratedFromSubdirectory(t *testing.T) {
+	isolateConfig(t)
+	repo := t.TempDir()
+	configPath := config.LocalConfigPath(repo)
+	for _, dir := range []string{filepath.Dir(configPath), filepath.Join(repo, "docs", "sub")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(configPath, []byte("server = \"http://repo.example\"\ntoken = \"old-token\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Chdir(t.TempDir())
+	if code, out := runHfile(t, "config", "get", "server", "--repo-dir", filepath.Join(repo, "docs", "sub")); code != 0 {
+		t.Fatalf("config get exited with %d:\n%s", code, out)
+	}
+
+	if token, _, err := config.LoadToken("http://repo.example"); err != nil || token != "old-token" {
+		t.Errorf("saved token = %q, %v, want old-token", token, err)
+	}
+	if data, _ := os.ReadFile(configPath); strings.Contains(string(data), "token") {
+		t.Errorf("token left in %s:\n%s", configPath, data)
+	}
+}
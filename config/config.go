@@ -4,16 +4,31 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/BurntSushi/toml"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
 	constant "github.com/litongjava/hfile/const"
 )
 
 type Config struct {
-	Server       string `toml:"server"`
+	Server string `toml:"server"`
+	// Token 和 RefreshToken 只用于迁移旧版本写入 config.toml 的凭证，
+	// 新的凭证保存在 ~/.hfile/credentials.toml
 	Token        string `toml:"token,omitempty"`
 	RefreshToken string `toml:"refresh_token,omitempty"`
+	Jobs         int    `toml:"jobs,omitzero"`
+	ChunkSize    int64  `toml:"chunk_size,omitzero"`
+	ChunkJobs    int    `toml:"chunk_jobs,omitzero"`
+	// Retry* 控制临时错误的重试，延迟为 Go duration 字符串，例如 "500ms"
+	RetryAttempts  int      `toml:"retry_attempts,omitzero"`
+	RetryBaseDelay string   `toml:"retry_base_delay,omitempty"`
+	RetryMaxDelay  string   `toml:"retry_max_delay,omitempty"`
+	RetryJitter    *float64 `toml:"retry_jitter,omitempty"`
+	// Repo 是仓库对应的远程仓库名，只在仓库的 .hfile/config.toml 中有效
+	Repo string `toml:"repo,omitempty"`
+	// Profile 是默认使用的 profile，Profiles 定义命名的服务器
+	Profile  string             `toml:"profile,omitempty"`
+	Profiles map[string]Profile `toml:"profiles,omitempty"`
 }
 
 // InitConfig initializes configuration file
@@ -36,21 +51,9 @@ func InitConfig(serverURL string) error {
 		serverURL = constant.ServerURL
 	}
 
-	config := Config{
-		Server: serverURL,
-	}
-
-	// Create config file
-	file, err := os.Create(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
-	}
-	defer file.Close()
-
-	// Write config
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(config); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+	// Write server, keeping the rest of an existing config file
+	if err := SetValue(configPath, "server", serverURL); err != nil {
+		return err
 	}
 
 	fmt.Printf("✅ Config file created: %s\n", configPath)
@@ -58,284 +61,125 @@ func InitConfig(serverURL string) error {
 	return nil
 }
 
-// LoadConfig loads config file with priority: current dir > ~/.hfile/config.toml > default
+// LoadConfig loads the server URL with priority:
+// profile given by --profile > HFILE_SERVER > HFILE_PROFILE > repo dir config > ~/.hfile/config.toml > default.
+// In a config file a profile wins over server, and the home dir config is only used when the
+// repo dir config sets neither.
 func LoadConfig(repoDir string) (string, error) {
-	// 1. Check repo directory config
-	if serverURL, err := loadFromRepoDir(repoDir); err == nil && serverURL != "" {
-		return serverURL, nil
-	}
-
-	// 2. Check user home directory config
-	if serverURL, err := loadFromHomeDir(); err == nil && serverURL != "" {
-		return serverURL, nil
-	}
-
-	// 3. Return default URL
-	return constant.ServerURL, nil
-}
-
-// loadFromRepoDir loads config from current directory
-func loadFromRepoDir(repoDir string) (string, error) {
-	configPath := filepath.Join(repoDir, ".hfile", "config.toml")
-	hlog.Info(configPath)
-	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("config file not found in current directory")
-	}
-
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return "", fmt.Errorf("failed to parse current directory config: %v", err)
-	}
-
-	if cfg.Server == "" {
-		return "", fmt.Errorf("server URL not set in current directory config")
-	}
-
-	return cfg.Server, nil
+	serverURL, _, err := LoadServerSource(repoDir)
+	return serverURL, err
 }
 
-// loadFromHomeDir loads config from user home directory
-func loadFromHomeDir() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+// LoadServerSource loads the server URL like LoadConfig and also describes where it came from
+func LoadServerSource(repoDir string) (string, string, error) {
+	// 0. An explicit --profile wins over the environment
+	if profileFromFlag {
+		serverURL, err := profileServer(repoDir)
+		return serverURL, "profile " + activeProfile, err
 	}
 
-	configPath := filepath.Join(homeDir, ".hfile", "config.toml")
-
-	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("config file not found in user home directory")
+	// 1. Environment variable
+	if serverURL := os.Getenv(EnvServer); serverURL != "" {
+		return serverURL, envSource(EnvServer), nil
 	}
 
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return "", fmt.Errorf("failed to parse user home directory config: %v", err)
-	}
-
-	if cfg.Server == "" {
-		return "", fmt.Errorf("server URL not set in user home directory config")
+	// 2. Use the server of the active profile. Apart from --profile it comes from HFILE_PROFILE or
+	// from the first config file that sets profile or server, see ResolveProfile.
+	if activeProfile != "" {
+		serverURL, err := profileServer(repoDir)
+		return serverURL, "profile " + activeProfile, err
 	}
 
-	return cfg.Server, nil
-}
-
-// ListConfigs displays all config information
-func ListConfigs(repoDir string) {
-	// Display active config
-	activeConfig, _ := LoadConfig(repoDir)
-	fmt.Printf("activte server: %s\n", activeConfig)
-
-	// Display current directory config
-	if cfg, err := getCurrentDirConfig(); err == nil {
-		fmt.Printf("current dir config - server: %s, token: %s\n", cfg.Server, maskToken(cfg.Token))
-	}
-
-	// Display home directory config
-	if cfg, err := getHomeDirConfig(); err == nil {
-		fmt.Printf("home dir config - server: %s, token: %s\n", cfg.Server, maskToken(cfg.Token))
-	}
-}
-
-// getCurrentDirConfig gets current directory config
-func getCurrentDirConfig() (Config, error) {
-	configPath := filepath.Join(".hfile", "config.toml")
-	_, err := os.Stat(configPath)
-
-	if err != nil {
-		if os.IsNotExist(err) {
-			hlog.Info("not found file:", configPath)
-			return Config{}, err
-		} else {
-			hlog.Error(err.Error())
-			return Config{}, err
+	// 3. Check repo directory config, 4. check user home directory config
+	for _, configPath := range configFilePaths(repoDir) {
+		if cfg, err := readConfigFile(configPath); err == nil && cfg.Server != "" {
+			return cfg.Server, configPath, nil
 		}
 	}
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return Config{}, err
-	}
 
-	return cfg, nil
+	// 5. Return default URL
+	return constant.ServerURL, SourceDefault, nil
 }
 
-// getHomeDirConfig gets user home directory config
-func getHomeDirConfig() (Config, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return Config{}, err
-	}
-
-	configPath := filepath.Join(homeDir, ".hfile", "config.toml")
-
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return Config{}, err
-	}
-
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return Config{}, err
-	}
-
-	return cfg, nil
+// intSettings 是整数配置项对应的环境变量和配置字段
+var intSettings = map[string]struct {
+	env string
+	get func(Config) int64
+}{
+	"jobs":           {EnvJobs, func(cfg Config) int64 { return int64(cfg.Jobs) }},
+	"chunk_size":     {EnvChunkSize, func(cfg Config) int64 { return cfg.ChunkSize }},
+	"chunk_jobs":     {EnvChunkJobs, func(cfg Config) int64 { return int64(cfg.ChunkJobs) }},
+	"retry_attempts": {EnvRetryAttempts, func(cfg Config) int64 { return int64(cfg.RetryAttempts) }},
 }
 
-// SaveToken saves token to the highest priority config file
-func SaveToken(token, refreshToken string) error {
-	// First check current directory config
-	configPath := filepath.Join(".hfile", "config.toml")
-	if _, err := os.Stat(configPath); err == nil {
-		return saveTokenToCurrentDir(token, refreshToken)
-	}
-
-	// Then check user home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %v", err)
-	}
-
-	configPath = filepath.Join(homeDir, ".hfile", "config.toml")
-	if _, err := os.Stat(configPath); err == nil {
-		return saveTokenToHomeDir(token, refreshToken)
-	}
-
-	// If no config file exists, create current directory config
-	return saveTokenToCurrentDir(token, refreshToken)
+// LoadJobs loads the number of concurrent transfers with priority:
+// HFILE_JOBS > repo dir > ~/.hfile/config.toml > 0 (use default)
+func LoadJobs(repoDir string) int {
+	jobs, _ := LoadIntSource(repoDir, "jobs")
+	return int(jobs)
 }
 
-// saveTokenToCurrentDir saves token to current directory config file
-func saveTokenToCurrentDir(token, refreshToken string) error {
-	configPath := filepath.Join(".hfile", "config.toml")
-
-	// Read existing config
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		// If file doesn't exist or parse fails, create new
-		cfg = Config{}
-
-		// Ensure .hfile directory exists
-		dir := filepath.Dir(configPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory: %v", err)
-		}
-	}
-
-	// Update token
-	cfg.Token = token
-	cfg.RefreshToken = refreshToken
-
-	// Preserve server URL if exists, otherwise set default
-	if cfg.Server == "" {
-		cfg.Server = constant.ServerURL
-	}
-
-	// Write back to file
-	file, err := os.Create(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
-	}
-	defer file.Close()
-
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(cfg); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
-	}
-
-	fmt.Printf("✅ Token saved to: %s\n", configPath)
-	return nil
+// LoadChunkSize loads the chunk size in bytes for chunked uploads, 0 means default
+func LoadChunkSize(repoDir string) int64 {
+	size, _ := LoadIntSource(repoDir, "chunk_size")
+	return size
 }
 
-// saveTokenToHomeDir saves token to user home directory config file
-func saveTokenToHomeDir(token, refreshToken string) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %v", err)
-	}
-
-	configDir := filepath.Join(homeDir, ".hfile")
-	configPath := filepath.Join(configDir, "config.toml")
-
-	// Read existing config
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return fmt.Errorf("failed to parse config file: %v", err)
-	}
-
-	// Update token
-	cfg.Token = token
-	cfg.RefreshToken = refreshToken
-
-	// Write back to file
-	file, err := os.Create(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
-	}
-	defer file.Close()
-
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(cfg); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
-	}
-
-	fmt.Printf("✅ Token saved to: %s\n", configPath)
-	return nil
+// LoadChunkJobs loads the number of concurrent chunk uploads per file, 0 means default
+func LoadChunkJobs(repoDir string) int {
+	jobs, _ := LoadIntSource(repoDir, "chunk_jobs")
+	return int(jobs)
 }
 
-// LoadToken loads token from config file following priority order
-func LoadToken() (string, string, error) {
-	// 1. Check current directory config
-	if token, refreshToken, err := loadTokenFromCurrentDir(); err == nil && token != "" {
-		return token, refreshToken, nil
+// LoadIntSource loads an integer setting (jobs, chunk_size, chunk_jobs or retry_attempts) and describes
+// where it came from, 0 means default
+func LoadIntSource(repoDir, key string) (int64, string) {
+	setting, ok := intSettings[key]
+	if !ok {
+		return 0, SourceDefault
 	}
-
-	// 2. Check user home directory config
-	if token, refreshToken, err := loadTokenFromHomeDir(); err == nil && token != "" {
-		return token, refreshToken, nil
-	}
-
-	return "", "", fmt.Errorf("no valid token configuration found")
+	return loadInt(repoDir, setting.env, setting.get)
 }
 
-// loadTokenFromCurrentDir loads token from current directory config file
-func loadTokenFromCurrentDir() (string, string, error) {
-	configPath := filepath.Join(".hfile", "config.toml")
-
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("config file not found in current directory")
+// loadInt returns the first positive value from the environment variable, repo dir config
+// and home dir config, together with its source
+func loadInt(repoDir, env string, get func(Config) int64) (int64, string) {
+	if value := os.Getenv(env); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+			return n, envSource(env)
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ Ignoring %s=%q: not a positive integer\n", env, value)
 	}
 
-	var cfg Config
-	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return "", "", fmt.Errorf("failed to parse current directory config: %v", err)
+	for _, configPath := range configFilePaths(repoDir) {
+		if cfg, err := readConfigFile(configPath); err == nil && get(cfg) > 0 {
+			return get(cfg), configPath
+		}
 	}
 
-	return cfg.Token, cfg.RefreshToken, nil
+	return 0, SourceDefault
 }
 
-// loadTokenFromHomeDir loads token from user home directory config file
-func loadTokenFromHomeDir() (string, string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", "", err
-	}
-
-	configPath := filepath.Join(homeDir, ".hfile", "config.toml")
-
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("config file not found in user home directory")
+// configFilePaths returns the repo dir config and the home dir config in priority order
+func configFilePaths(repoDir string) []string {
+	paths := []string{LocalConfigPath(repoDir)}
+	if globalPath, err := GlobalConfigPath(); err == nil {
+		paths = append(paths, globalPath)
 	}
+	return paths
+}
 
+// readConfigFile decodes a config file
+func readConfigFile(configPath string) (Config, error) {
 	var cfg Config
 	if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
-		return "", "", fmt.Errorf("failed to parse user home directory config: %v", err)
+		return Config{}, err
 	}
-
-	return cfg.Token, cfg.RefreshToken, nil
+	return cfg, nil
 }
 
-// maskToken masks token for display purposes
-func maskToken(token string) string {
+// MaskToken masks token for display purposes
+func MaskToken(token string) string {
 	if len(token) <= 10 {
 		return "****"
 	}
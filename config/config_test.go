@@ -0,0 +1,219 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	constant "github.com/litongjava/hfile/const"
+)
+
+const testProfiles = `
+[profiles.prod]
+server = "http://prod.example"
+
+[profiles.staging]
+server = "http://staging.example"
+`
+
+func TestLoadServerSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		homeConfig string
+		repoConfig string
+		env        map[string]string
+		flag       string
+
+		wantServer  string
+		wantSource  string // "home" 和 "repo" 表示对应的配置文件
+		wantProfile string
+		wantErr     string
+	}{
+		{name: "default", wantServer: constant.ServerURL, wantSource: SourceDefault},
+		{
+			name:       "home config",
+			homeConfig: `server = "http://home.example"`,
+			wantServer: "http://home.example", wantSource: "home",
+		},
+		{
+			name:       "repo config over home config",
+			homeConfig: `server = "http://home.example"`,
+			repoConfig: `server = "http://repo.example"`,
+			wantServer: "http://repo.example", wantSource: "repo",
+		},
+		{
+			name:       "env over repo config",
+			repoConfig: `server = "http://repo.example"`,
+			env:        map[string]string{EnvServer: "http://env.example"},
+			wantServer: "http://env.example", wantSource: "env " + EnvServer,
+		},
+		{
+			name:        "flag profile over env",
+			homeConfig:  testProfiles,
+			env:         map[string]string{EnvServer: "http://env.example"},
+			flag:        "prod",
+			wantServer:  "http://prod.example",
+			wantSource:  "profile prod",
+			wantProfile: "prod",
+		},
+		{
+			name:        "flag profile over repo profile",
+			homeConfig:  testProfiles,
+			repoConfig:  `profile = "staging"`,
+			flag:        "prod",
+			wantServer:  "http://prod.example",
+			wantSource:  "profile prod",
+			wantProfile: "prod",
+		},
+		{
+			name:        "env profile over repo server",
+			homeConfig:  testProfiles,
+			repoConfig:  `server = "http://repo.example"`,
+			env:         map[string]string{EnvProfile: "staging"},
+			wantServer:  "http://staging.example",
+			wantSource:  "profile staging",
+			wantProfile: "staging",
+		},
+		{
+			name:       "env server over env profile",
+			homeConfig: testProfiles,
+			env:        map[string]string{EnvServer: "http://env.example", EnvProfile: "staging"},
+			wantServer: "http://env.example", wantSource: "env " + EnvServer, wantProfile: "staging",
+		},
+		{
+			name:        "repo profile over repo server",
+			homeConfig:  testProfiles,
+			repoConfig:  "profile = \"staging\"\nserver = \"http://repo.example\"\n",
+			wantServer:  "http://staging.example",
+			wantSource:  "profile staging",
+			wantProfile: "staging",
+		},
+		{
+			name:        "repo profile over home profile",
+			homeConfig:  "profile = \"prod\"\n" + testProfiles,
+			repoConfig:  `profile = "staging"`,
+			wantServer:  "http://staging.example",
+			wantSource:  "profile staging",
+			wantProfile: "staging",
+		},
+		{
+			name:        "profile defined in repo config",
+			repoConfig:  "profile = \"local\"\n[profiles.local]\nserver = \"http://local.example\"\n",
+			wantServer:  "http://local.example",
+			wantSource:  "profile local",
+			wantProfile: "local",
+		},
+		{
+			name:       "repo server over home profile",
+			homeConfig: "profile = \"prod\"\n" + testProfiles,
+			repoConfig: `server = "http://repo.example"`,
+			wantServer: "http://repo.example", wantSource: "repo",
+		},
+		{
+			name:        "home profile when repo config sets neither",
+			homeConfig:  "profile = \"prod\"\n" + testProfiles,
+			repoConfig:  "repo = \"demo\"\njobs = 2\n",
+			wantServer:  "http://prod.example",
+			wantSource:  "profile prod",
+			wantProfile: "prod",
+		},
+		{
+			name:        "home profile over home server",
+			homeConfig:  "server = \"http://home.example\"\nprofile = \"prod\"\n" + testProfiles,
+			wantServer:  "http://prod.example",
+			wantSource:  "profile prod",
+			wantProfile: "prod",
+		},
+		{
+			name:       "undefined profile",
+			homeConfig: testProfiles,
+			flag:       "nope",
+			wantErr:    `profile "nope" is not defined in any config file`,
+		},
+		{
+			name:       "profile without server",
+			homeConfig: "[profiles.empty]\n",
+			repoConfig: `profile = "empty"`,
+			wantErr:    `server not set for profile "empty"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupConfigDirs(t, tt.homeConfig, tt.repoConfig)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			profile, err := ResolveProfile(repo, tt.flag)
+			if err == nil {
+				SetActiveProfile(profile, tt.flag != "")
+				var server, source string
+				server, source, err = LoadServerSource(repo)
+				if err == nil {
+					if profile != tt.wantProfile {
+						t.Errorf("profile = %q, want %q", profile, tt.wantProfile)
+					}
+					if server != tt.wantServer {
+						t.Errorf("server = %q, want %q", server, tt.wantServer)
+					}
+					if want := testSource(repo, tt.wantSource); source != want {
+						t.Errorf("source = %q, want %q", source, want)
+					}
+				}
+			}
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadIntSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		homeConfig string
+		repoConfig string
+		env        string
+		want       int64
+		wantSource string
+	}{
+		{name: "default", want: 0, wantSource: SourceDefault},
+		{name: "home config", homeConfig: "jobs = 2", want: 2, wantSource: "home"},
+		{name: "repo config over home config", homeConfig: "jobs = 2", repoConfig: "jobs = 3", want: 3, wantSource: "repo"},
+		{name: "env over repo config", repoConfig: "jobs = 3", env: "5", want: 5, wantSource: "env " + EnvJobs},
+		{name: "invalid env is ignored", repoConfig: "jobs = 3", env: "many", want: 3, wantSource: "repo"},
+		{name: "zero in repo config falls through", homeConfig: "jobs = 2", repoConfig: "jobs = 0", want: 2, wantSource: "home"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupConfigDirs(t, tt.homeConfig, tt.repoConfig)
+			t.Setenv(EnvJobs, tt.env)
+
+			got, source := LoadIntSource(repo, "jobs")
+			if got != tt.want {
+				t.Errorf("jobs = %d, want %d", got, tt.want)
+			}
+			if want := testSource(repo, tt.wantSource); source != want {
+				t.Errorf("source = %q, want %q", source, want)
+			}
+		})
+	}
+}
+
+// testSource 把测试用例中的 "home" 和 "repo" 换成对应配置文件的路径
+func testSource(repo, source string) string {
+	switch source {
+	case "home":
+		path, _ := GlobalConfigPath()
+		return path
+	case "repo":
+		return filepath.Clean(LocalConfigPath(repo))
+	}
+	return source
+}
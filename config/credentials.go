@@ -0,0 +1,298 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	constant "github.com/litongjava/hfile/const"
+	"github.com/litongjava/hfile/utils"
+)
+
+// CredentialsFileName 保存登录凭证的文件，位于 ~/.hfile 下，权限 0600
+const CredentialsFileName = "credentials.toml"
+
+// Credential 是一个服务器的登录凭证，按 profile 保存时 Server 记录 profile 对应的服务器
+type Credential struct {
+	Server       string `toml:"server,omitempty"`
+	Token        string `toml:"token"`
+	RefreshToken string `toml:"refresh_token,omitempty"`
+}
+
+// Credentials 是 credentials.toml 的内容，未使用 profile 时按服务器 URL 保存凭证，
+// 使用 profile 时按 profile 名保存：
+//
+//	[servers."https://hfile.example.com"]
+//	token = "..."
+//	refresh_token = "..."
+//
+//	[profiles.staging]
+//	server = "https://staging.example.com"
+//	token = "..."
+type Credentials struct {
+	Servers  map[string]Credential `toml:"servers"`
+	Profiles map[string]Credential `toml:"profiles,omitempty"`
+}
+
+// SavedToken 是一个已保存的凭证，Profile 为空时表示按服务器保存
+type SavedToken struct {
+	Profile      string
+	Server       string
+	Token        string
+	RefreshToken string
+}
+
+// CredentialsPath returns the path of ~/.hfile/credentials.toml
+func CredentialsPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".hfile", CredentialsFileName), nil
+}
+
+// LoadToken loads the token and refresh token saved for serverURL
+func LoadToken(serverURL string) (string, string, error) {
+	token, refreshToken, _, err := LoadTokenSource(serverURL)
+	return token, refreshToken, err
+}
+
+// LoadTokenSource loads token like LoadToken and also describes where it came from:
+// HFILE_TOKEN > credentials file. HFILE_REFRESH_TOKEN overrides the saved refresh token.
+func LoadTokenSource(serverURL string) (string, string, string, error) {
+	if token := os.Getenv(EnvToken); token != "" {
+		return token, os.Getenv(EnvRefreshToken), envSource(EnvToken), nil
+	}
+
+	creds, err := LoadCredentials()
+	if err != nil {
+		return "", "", "", err
+	}
+	cred, ok := creds.lookup(serverURL)
+	if !ok || cred.Token == "" {
+		if activeProfile != "" {
+			return "", "", "", fmt.Errorf("no token saved for profile %s on %s", activeProfile, serverURL)
+		}
+		return "", "", "", fmt.Errorf("no token saved for %s", serverURL)
+	}
+	if refresh := os.Getenv(EnvRefreshToken); refresh != "" {
+		cred.RefreshToken = refresh
+	}
+	path, _ := CredentialsPath()
+	return cred.Token, cred.RefreshToken, path, nil
+}
+
+// SaveToken saves token for serverURL to the credentials file and returns its path
+func SaveToken(serverURL, token, refreshToken string) (string, error) {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return "", err
+	}
+	if activeProfile != "" {
+		creds.Profiles[activeProfile] = Credential{Server: serverURL, Token: token, RefreshToken: refreshToken}
+	} else {
+		creds.Servers[serverKey(serverURL)] = Credential{Token: token, RefreshToken: refreshToken}
+	}
+	return saveCredentials(creds)
+}
+
+// ClearToken removes the token saved for serverURL, returns false if there was none
+func ClearToken(serverURL string) (bool, error) {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := creds.lookup(serverURL); !ok {
+		return false, nil
+	}
+	if activeProfile != "" {
+		delete(creds.Profiles, activeProfile)
+	} else {
+		delete(creds.Servers, serverKey(serverURL))
+	}
+	_, err = saveCredentials(creds)
+	return err == nil, err
+}
+
+// SavedTokens returns every saved credential, servers first and then profiles
+func SavedTokens() ([]SavedToken, error) {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	var tokens []SavedToken
+	for _, server := range utils.SortedKeys(creds.Servers) {
+		cred := creds.Servers[server]
+		tokens = append(tokens, SavedToken{Server: server, Token: cred.Token, RefreshToken: cred.RefreshToken})
+	}
+	for _, name := range utils.SortedKeys(creds.Profiles) {
+		cred := creds.Profiles[name]
+		tokens = append(tokens, SavedToken{Profile: name, Server: cred.Server, Token: cred.Token, RefreshToken: cred.RefreshToken})
+	}
+	return tokens, nil
+}
+
+// ClearAllTokens removes every saved credential
+func ClearAllTokens() error {
+	_, err := saveCredentials(Credentials{Servers: map[string]Credential{}})
+	return err
+}
+
+// lookup returns the credential of the active profile, or of serverURL when no profile is active.
+// A profile credential saved for another server is not returned, so that its token is never
+// sent to a server overridden by --server or HFILE_SERVER.
+func (c Credentials) lookup(serverURL string) (Credential, bool) {
+	if activeProfile != "" {
+		cred, ok := c.Profiles[activeProfile]
+		if !ok || serverKey(cred.Server) != serverKey(serverURL) {
+			return Credential{}, false
+		}
+		return cred, true
+	}
+	cred, ok := c.Servers[serverKey(serverURL)]
+	return cred, ok
+}
+
+// LoadCredentials reads the credentials file, a missing file yields empty credentials
+func LoadCredentials() (Credentials, error) {
+	creds := Credentials{Servers: map[string]Credential{}, Profiles: map[string]Credential{}}
+	path, err := CredentialsPath()
+	if err != nil {
+		return creds, err
+	}
+
+	if _, err := toml.DecodeFile(path, &creds); err != nil {
+		if os.IsNotExist(err) {
+			return creds, nil
+		}
+		return creds, fmt.Errorf("failed to parse credentials file: %v", err)
+	}
+	if creds.Servers == nil {
+		creds.Servers = map[string]Credential{}
+	}
+	if creds.Profiles == nil {
+		creds.Profiles = map[string]Credential{}
+	}
+	warnIfWorldReadable(path)
+	return creds, nil
+}
+
+// saveCredentials writes the credentials file with 0600 permissions and returns its path
+func saveCredentials(creds Credentials) (string, error) {
+	path, err := CredentialsPath()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// 先写临时文件再重命名，CreateTemp 创建的文件权限为 0600
+	file, err := os.CreateTemp(dir, ".credentials-*.toml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create credentials file: %v", err)
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	if err := toml.NewEncoder(file).Encode(creds); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write credentials file: %v", err)
+	}
+	if err := file.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		file.Close()
+		return "", fmt.Errorf("failed to set credentials file permissions: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write credentials file: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("failed to save credentials file: %v", err)
+	}
+	return path, nil
+}
+
+// MigrateLegacyTokens moves tokens that older versions saved in the repo dir and home dir
+// config.toml into the credentials file and then removes them from config.toml
+func MigrateLegacyTokens(repoDir string) error {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return err
+	}
+
+	var migrated []string
+	for _, configPath := range legacyTokenPaths(repoDir) {
+		cfg, err := readConfigFile(configPath)
+		if err != nil || (cfg.Token == "" && cfg.RefreshToken == "") {
+			continue
+		}
+		warnIfWorldReadable(configPath)
+
+		server := cfg.Server
+		if server == "" {
+			server = constant.ServerURL
+		}
+		// 已有凭证时以 credentials.toml 为准
+		if _, ok := creds.Servers[serverKey(server)]; !ok && cfg.Token != "" {
+			creds.Servers[serverKey(server)] = Credential{Token: cfg.Token, RefreshToken: cfg.RefreshToken}
+		}
+		migrated = append(migrated, configPath)
+	}
+	if len(migrated) == 0 {
+		return nil
+	}
+
+	path, err := saveCredentials(creds)
+	if err != nil {
+		return fmt.Errorf("failed to migrate tokens: %v", err)
+	}
+	for _, configPath := range migrated {
+		if err := clearLegacyToken(configPath); err != nil {
+			return fmt.Errorf("failed to remove token from %s: %v", configPath, err)
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ Moved token from %s to %s\n", configPath, path)
+	}
+	return nil
+}
+
+// legacyTokenPaths returns the config files older versions saved tokens to
+func legacyTokenPaths(repoDir string) []string {
+	var paths []string
+	if abs, err := filepath.Abs(LocalConfigPath(repoDir)); err == nil {
+		paths = append(paths, abs)
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		home := filepath.Join(homeDir, ".hfile", "config.toml")
+		if len(paths) == 0 || paths[0] != home {
+			paths = append(paths, home)
+		}
+	}
+	return paths
+}
+
+// clearLegacyToken removes token and refresh token from a config file
+func clearLegacyToken(configPath string) error {
+	_, err := removeConfigKeys(configPath, []string{"token"}, []string{"refresh_token"})
+	return err
+}
+
+// warnIfWorldReadable warns when a file holding a token can be read by other users
+func warnIfWorldReadable(path string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0004 == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "⚠️ Token found in world-readable file %s (mode %v)\n", path, info.Mode().Perm())
+}
+
+// serverKey normalizes a server URL so that "http://host/" and "http://host" share credentials
+func serverKey(serverURL string) string {
+	return strings.TrimRight(serverURL, "/")
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	constant "github.com/litongjava/hfile/const"
+)
+
+func TestMigrateLegacyTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		homeConfig  string
+		repoConfig  string
+		credentials string
+
+		want     map[string]string // 服务器 -> 迁移后 credentials.toml 中的 token
+		wantHome string            // 迁移后用户主目录 config.toml 的内容
+		wantRepo string            // 迁移后仓库 config.toml 的内容
+	}{
+		{
+			name:       "token in repo config",
+			repoConfig: "server = \"http://repo.example\"\ntoken = \"repo-token\"\nrefresh_token = \"repo-refresh\"\njobs = 2\n",
+			want:       map[string]string{"http://repo.example": "repo-token"},
+			wantRepo:   "server = \"http://repo.example\"\njobs = 2\n",
+		},
+		{
+			name:       "token in home config",
+			homeConfig: "# home\ntoken = \"home-token\"\n",
+			want:       map[string]string{constant.ServerURL: "home-token"},
+			wantHome:   "# home\n",
+		},
+		{
+			name:       "tokens in both configs",
+			homeConfig: "server = \"http://home.example\"\ntoken = \"home-token\"\n",
+			repoConfig: "server = \"http://repo.example/\"\ntoken = \"repo-token\"\n",
+			want:       map[string]string{"http://home.example": "home-token", "http://repo.example": "repo-token"},
+			wantHome:   "server = \"http://home.example\"\n",
+			wantRepo:   "server = \"http://repo.example/\"\n",
+		},
+		{
+			name:        "saved credential wins",
+			repoConfig:  "server = \"http://repo.example\"\ntoken = \"old-token\"\n",
+			credentials: "[servers.\"http://repo.example\"]\ntoken = \"new-token\"\n",
+			want:        map[string]string{"http://repo.example": "new-token"},
+			wantRepo:    "server = \"http://repo.example\"\n",
+		},
+		{
+			name:       "no tokens",
+			repoConfig: "server = \"http://repo.example\"\n",
+			want:       map[string]string{},
+			wantRepo:   "server = \"http://repo.example\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupConfigDirs(t, tt.homeConfig, tt.repoConfig)
+			credsPath, _ := CredentialsPath()
+			writeTestConfig(t, credsPath, tt.credentials)
+
+			// 当前目录不是仓库，迁移只能依靠传入的仓库目录找到 config.toml
+			t.Chdir(t.TempDir())
+			if err := MigrateLegacyTokens(repo); err != nil {
+				t.Fatalf("MigrateLegacyTokens: %v", err)
+			}
+
+			creds, err := LoadCredentials()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for server, cred := range creds.Servers {
+				got[server] = cred.Token
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("credentials = %v, want %v", got, tt.want)
+			}
+			for server, token := range tt.want {
+				if got[server] != token {
+					t.Errorf("token for %s = %q, want %q", server, got[server], token)
+				}
+			}
+
+			homePath, _ := GlobalConfigPath()
+			for path, want := range map[string]string{homePath: tt.wantHome, LocalConfigPath(repo): tt.wantRepo} {
+				data, _ := os.ReadFile(path)
+				if string(data) != want {
+					t.Errorf("%s =\n%s\nwant\n%s", path, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialsLookup(t *testing.T) {
+	setupConfigDirs(t, "", "")
+	if _, err := SaveToken("http://a.example/", "server-token", "server-refresh"); err != nil {
+		t.Fatal(err)
+	}
+	SetActiveProfile("prod", false)
+	if _, err := SaveToken("http://prod.example", "prod-token", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		server  string
+		want    string
+		wantErr string
+	}{
+		{name: "server credential", server: "http://a.example", want: "server-token"},
+		{name: "server credential with trailing slash", server: "http://a.example/", want: "server-token"},
+		{name: "unknown server", server: "http://b.example", wantErr: "no token saved for http://b.example"},
+		{name: "profile credential", profile: "prod", server: "http://prod.example", want: "prod-token"},
+		{
+			name:    "profile credential on another server",
+			profile: "prod", server: "http://a.example",
+			wantErr: "no token saved for profile prod on http://a.example",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetActiveProfile(tt.profile, false)
+			token, _, err := LoadToken(tt.server)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadToken error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || token != tt.want {
+				t.Fatalf("LoadToken = %q, %v, want %q", token, err, tt.want)
+			}
+		})
+	}
+
+	SetActiveProfile("", false)
+	tokens, err := SavedTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, token.Profile+"@"+token.Server)
+	}
+	if want := "@http://a.example prod@http://prod.example"; strings.Join(got, " ") != want {
+		t.Errorf("SavedTokens = %q, want %q", got, want)
+	}
+
+	info, err := os.Stat(filepath.Join(os.Getenv("HOME"), ".hfile", CredentialsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credentials file mode = %v, want 0600", perm)
+	}
+}
@@ -0,0 +1,578 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// valueKind 是配置项的取值类型
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindURL
+	kindPositiveInt
+	kindRepoName
+	kindDuration
+	kindRatio
+)
+
+// keySpec 描述一个可以通过 config get/set/unset 修改的配置项
+type keySpec struct {
+	Name string
+	Kind valueKind
+}
+
+// configKeys 是 config.toml 中允许修改的配置项，profiles.<name>.server 单独处理
+var configKeys = []keySpec{
+	{Name: "server", Kind: kindURL},
+	{Name: "jobs", Kind: kindPositiveInt},
+	{Name: "chunk_size", Kind: kindPositiveInt},
+	{Name: "chunk_jobs", Kind: kindPositiveInt},
+	{Name: "retry_attempts", Kind: kindPositiveInt},
+	{Name: "retry_base_delay", Kind: kindDuration},
+	{Name: "retry_max_delay", Kind: kindDuration},
+	{Name: "retry_jitter", Kind: kindRatio},
+	{Name: "profile", Kind: kindString},
+	{Name: "repo", Kind: kindRepoName},
+}
+
+// ConfigKeys returns the keys accepted by config get/set/unset
+func ConfigKeys() []string {
+	keys := make([]string, 0, len(configKeys)+1)
+	for _, spec := range configKeys {
+		keys = append(keys, spec.Name)
+	}
+	return append(keys, "profiles.<name>.server")
+}
+
+// LocalConfigPath returns the config file of the repository
+func LocalConfigPath(repoDir string) string {
+	return filepath.Join(repoDir, ".hfile", "config.toml")
+}
+
+// GlobalConfigPath returns ~/.hfile/config.toml
+func GlobalConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".hfile", "config.toml"), nil
+}
+
+// GetValue returns the value of key in the config file, false if it is not set
+func GetValue(configPath, key string) (string, bool, error) {
+	path, _, err := parseKey(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	var data map[string]interface{}
+	if _, err := toml.DecodeFile(configPath, &data); err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	var value interface{} = data
+	for _, part := range path {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false, nil
+		}
+		if value, ok = table[part]; !ok {
+			return "", false, nil
+		}
+	}
+	if _, ok := value.(map[string]interface{}); ok {
+		return "", false, fmt.Errorf("%s is a table, not a value", key)
+	}
+	return fmt.Sprint(value), true, nil
+}
+
+// SetValue validates value and writes key = value into the config file in place,
+// keeping comments, ordering and keys it does not know about
+func SetValue(configPath, key, value string) error {
+	path, spec, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeValue(spec, value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	return editConfigFile(configPath, path, encoded)
+}
+
+// UnsetValue removes key from the config file, false if it was not set
+func UnsetValue(configPath, key string) (bool, error) {
+	path, _, err := parseKey(key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return false, nil
+	}
+	return removeConfigKeys(configPath, path)
+}
+
+// parseKey checks key against the schema and splits it into its TOML path
+func parseKey(key string) ([]string, keySpec, error) {
+	for _, spec := range configKeys {
+		if key == spec.Name {
+			return []string{key}, spec, nil
+		}
+	}
+
+	// profiles.<name>.server，name 中可以包含点号
+	if strings.HasPrefix(key, "profiles.") && strings.HasSuffix(key, ".server") {
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "profiles."), ".server")
+		if name != "" {
+			return []string{"profiles", name, "server"}, keySpec{Name: key, Kind: kindURL}, nil
+		}
+	}
+
+	return nil, keySpec{}, fmt.Errorf("unknown config key %q, known keys: %s", key, strings.Join(ConfigKeys(), ", "))
+}
+
+// ValidateRepoName checks that name can be used as a remote repository name
+func ValidateRepoName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%q is not a valid repository name", name)
+	}
+	for _, c := range name {
+		if c == '/' || c == '\\' || unicode.IsControl(c) {
+			return fmt.Errorf("repository name %q must not contain %q", name, c)
+		}
+	}
+	return nil
+}
+
+// encodeValue validates value and returns it as a TOML value
+func encodeValue(spec keySpec, value string) (string, error) {
+	switch spec.Kind {
+	case kindURL:
+		u, err := url.Parse(value)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return "", fmt.Errorf("%q is not an http(s) URL", value)
+		}
+		return strconv.Quote(value), nil
+	case kindPositiveInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("%q is not a positive integer", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case kindDuration:
+		if _, err := parseDuration(value); err != nil {
+			return "", err
+		}
+		return strconv.Quote(value), nil
+	case kindRatio:
+		r, err := parseRatio(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(r, 'f', -1, 64), nil
+	case kindRepoName:
+		if err := ValidateRepoName(value); err != nil {
+			return "", err
+		}
+		return strconv.Quote(value), nil
+	default:
+		if value == "" {
+			return "", fmt.Errorf("value must not be empty")
+		}
+		return strconv.Quote(value), nil
+	}
+}
+
+// editConfigFile sets the key at path to an encoded TOML value. An existing entry is
+// replaced on its own line, otherwise the key is added to the end of its table.
+func editConfigFile(configPath string, path []string, encoded string) error {
+	content, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	lines := splitLines(string(content))
+	entries, tables := scanTOML(lines)
+
+	table, key := path[:len(path)-1], path[len(path)-1]
+	newLine := formatKey(key) + " = " + encoded
+
+	if e, ok := findEntry(entries, path); ok {
+		indent := lines[e.start][:len(lines[e.start])-len(strings.TrimLeft(lines[e.start], " \t"))]
+		replaced := indent + lines[e.start][len(indent):e.keyEnd] + "= " + encoded
+		if e.comment != "" {
+			replaced += " " + e.comment
+		}
+		lines = append(lines[:e.start], append([]string{replaced}, lines[e.end+1:]...)...)
+	} else if at, ok := insertPosition(lines, entries, tables, table); ok {
+		lines = append(lines[:at], append([]string{newLine}, lines[at:]...)...)
+	} else {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, formatTable(table), newLine)
+	}
+
+	return writeConfigLines(configPath, lines)
+}
+
+// removeConfigKeys removes the entries at the given paths, false if none was set
+func removeConfigKeys(configPath string, paths ...[]string) (bool, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %v", err)
+	}
+	lines := splitLines(string(content))
+	entries, _ := scanTOML(lines)
+
+	remove := make(map[int]bool)
+	for _, path := range paths {
+		if e, ok := findEntry(entries, path); ok {
+			for i := e.start; i <= e.end; i++ {
+				remove[i] = true
+			}
+		}
+	}
+	if len(remove) == 0 {
+		return false, nil
+	}
+
+	kept := lines[:0:0]
+	for i, line := range lines {
+		if !remove[i] {
+			kept = append(kept, line)
+		}
+	}
+	return true, writeConfigLines(configPath, kept)
+}
+
+// writeConfigLines checks that the edited file is still valid TOML and replaces the
+// original atomically, keeping its permissions
+func writeConfigLines(configPath string, lines []string) error {
+	content := strings.Join(lines, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	var check map[string]interface{}
+	if _, err := toml.Decode(content, &check); err != nil {
+		return fmt.Errorf("refusing to write invalid config file: %v", err)
+	}
+
+	dir := filepath.Dir(configPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	file, err := os.CreateTemp(dir, ".config-*.toml")
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %v", err)
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	file.Chmod(mode)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	if err := os.Rename(tmpPath, configPath); err != nil {
+		return fmt.Errorf("failed to save config file: %v", err)
+	}
+	return nil
+}
+
+// tomlEntry 是文件中的一个 key = value，可能跨多行
+type tomlEntry struct {
+	path    []string // 完整路径，包含所在的表
+	start   int      // 第一行
+	end     int      // 最后一行
+	keyEnd  int      // 第一行中 "=" 的位置
+	comment string   // 单行值后面的注释
+}
+
+// tomlTable 是文件中的一个 [table] 头
+type tomlTable struct {
+	path []string
+	line int
+}
+
+// scanTOML finds the key/value entries and table headers of a TOML file line by line.
+// It understands multi-line strings and arrays well enough not to mistake their
+// contents for keys or headers.
+func scanTOML(lines []string) ([]tomlEntry, []tomlTable) {
+	var entries []tomlEntry
+	var tables []tomlTable
+	var current []string
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") {
+			header := strings.TrimPrefix(trimmed, "[")
+			array := strings.HasPrefix(header, "[")
+			header = strings.TrimPrefix(header, "[")
+			if end := closingBracket(header); end >= 0 {
+				current = splitKeyPath(header[:end])
+				if !array {
+					tables = append(tables, tomlTable{path: current, line: i})
+				}
+			}
+			continue
+		}
+
+		eq := keyEnd(lines[i])
+		if eq < 0 {
+			continue
+		}
+		entry := tomlEntry{
+			path:   append(append([]string{}, current...), splitKeyPath(lines[i][:eq])...),
+			start:  i,
+			keyEnd: eq,
+		}
+
+		// 找到值结束的位置，值可能是多行字符串或多行数组
+		st := &valueScanner{}
+		rest := lines[i][eq+1:]
+		comment := st.scan(rest)
+		for st.open() && i+1 < len(lines) {
+			i++
+			comment = st.scan(lines[i])
+		}
+		entry.end = i
+		if entry.start == entry.end {
+			entry.comment = comment
+		}
+		entries = append(entries, entry)
+	}
+	return entries, tables
+}
+
+// valueScanner 跟踪值中的字符串和方括号，判断值是否在下一行继续
+type valueScanner struct {
+	delim string // 当前所在字符串的定界符
+	depth int    // 未闭合的 [ 和 { 的数量
+}
+
+func (s *valueScanner) open() bool {
+	return s.delim != "" || s.depth > 0
+}
+
+// scan consumes one line and returns the trailing comment, if any
+func (s *valueScanner) scan(line string) string {
+	for i := 0; i < len(line); i++ {
+		if s.delim != "" {
+			if s.delim == `"` || s.delim == `"""` {
+				if line[i] == '\\' {
+					i++
+					continue
+				}
+			}
+			if strings.HasPrefix(line[i:], s.delim) {
+				i += len(s.delim) - 1
+				s.delim = ""
+			}
+			continue
+		}
+		switch c := line[i]; {
+		case c == '#':
+			return strings.TrimSpace(line[i:])
+		case strings.HasPrefix(line[i:], `"""`) || strings.HasPrefix(line[i:], `'''`):
+			s.delim = line[i : i+3]
+			i += 2
+		case c == '"' || c == '\'':
+			s.delim = string(c)
+		case c == '[' || c == '{':
+			s.depth++
+		case c == ']' || c == '}':
+			s.depth--
+		}
+	}
+	// 单行字符串不能跨行
+	if len(s.delim) == 1 {
+		s.delim = ""
+	}
+	return ""
+}
+
+// keyEnd returns the position of the "=" separating key and value, or -1
+func keyEnd(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		case c == '#':
+			return -1
+		}
+	}
+	return -1
+}
+
+// closingBracket returns the position of the "]" closing a table header, or -1
+func closingBracket(header string) int {
+	var quote byte
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitKeyPath splits a dotted TOML key such as profiles."my server" into its parts
+func splitKeyPath(key string) []string {
+	var parts []string
+	var part strings.Builder
+	var quote byte
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(key) {
+				i++
+				part.WriteByte(key[i])
+			} else if c == quote {
+				quote = 0
+			} else {
+				part.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		case c == ' ' || c == '\t':
+		default:
+			part.WriteByte(c)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// findEntry returns the entry at path
+func findEntry(entries []tomlEntry, path []string) (tomlEntry, bool) {
+	for _, e := range entries {
+		if samePath(e.path, path) {
+			return e, true
+		}
+	}
+	return tomlEntry{}, false
+}
+
+// insertPosition returns the line a new key of table should be inserted at:
+// after the last entry of the table, or right after its header
+func insertPosition(lines []string, entries []tomlEntry, tables []tomlTable, table []string) (int, bool) {
+	// 顶层的 key 必须写在第一个表头之前
+	if len(table) == 0 {
+		at := 0
+		for _, e := range entries {
+			if len(tables) > 0 && e.start > tables[0].line {
+				break
+			}
+			at = e.end + 1
+		}
+		return at, true
+	}
+
+	for t, header := range tables {
+		if !samePath(header.path, table) {
+			continue
+		}
+		next := len(lines)
+		if t+1 < len(tables) {
+			next = tables[t+1].line
+		}
+		at := header.line + 1
+		for _, e := range entries {
+			if e.start > header.line && e.start < next {
+				at = e.end + 1
+			}
+		}
+		return at, true
+	}
+	return 0, false
+}
+
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatKey quotes a key part when it is not a bare key
+func formatKey(key string) string {
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return strconv.Quote(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+// formatTable formats a table header
+func formatTable(table []string) string {
+	parts := make([]string, len(table))
+	for i, part := range table {
+		parts[i] = formatKey(part)
+	}
+	return "[" + strings.Join(parts, ".") + "]"
+}
+
+// splitLines splits content into lines without the trailing empty line
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // 为空表示文件不存在
+		key     string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "new file",
+			key:   "server",
+			value: "http://a.example",
+			want:  "server = \"http://a.example\"\n",
+		},
+		{
+			name: "keeps comments and key order",
+			content: `# hfile config
+server = "http://a.example" # main server
+jobs = 2
+
+# retries
+retry_attempts = 3
+`,
+			key:   "server",
+			value: "http://b.example",
+			want: `# hfile config
+server = "http://b.example" # main server
+jobs = 2
+
+# retries
+retry_attempts = 3
+`,
+		},
+		{
+			name:    "keeps the key spacing",
+			content: "jobs    =   2\nserver = \"http://a.example\"\n",
+			key:     "jobs",
+			value:   "8",
+			want:    "jobs    = 8\nserver = \"http://a.example\"\n",
+		},
+		{
+			name:    "top-level key goes before the first table",
+			content: "server = \"http://a.example\"\n\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+			key:     "jobs",
+			value:   "4",
+			want:    "server = \"http://a.example\"\njobs = 4\n\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+		},
+		{
+			name:    "top-level key in a file that starts with a table",
+			content: "[profiles.prod]\nserver = \"http://prod.example\"\n",
+			key:     "jobs",
+			value:   "4",
+			want:    "jobs = 4\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+		},
+		{
+			name: "multi-line basic string",
+			content: `note = """
+server = "http://fake.example"
+[profiles.fake]
+"""
+jobs = 2
+`,
+			key:   "server",
+			value: "http://a.example",
+			want: `note = """
+server = "http://fake.example"
+[profiles.fake]
+"""
+jobs = 2
+server = "http://a.example"
+`,
+		},
+		{
+			name: "multi-line literal string",
+			content: `note = '''
+jobs = 99 # not a key
+'''
+jobs = 2
+`,
+			key:   "jobs",
+			value: "3",
+			want: `note = '''
+jobs = 99 # not a key
+'''
+jobs = 3
+`,
+		},
+		{
+			name:    "literal string with backslash and hash",
+			content: "repo = 'C:\\data\\' # windows path\njobs = 2\n",
+			key:     "repo",
+			value:   "photos",
+			want:    "repo = \"photos\" # windows path\njobs = 2\n",
+		},
+		{
+			name:    "escaped quote in basic string",
+			content: "profile = \"a\\\"# b\" # comment\n",
+			key:     "profile",
+			value:   "prod",
+			want:    "profile = \"prod\" # comment\n",
+		},
+		{
+			name:    "multi-line value is replaced as a whole",
+			content: "server = \"\"\"\nhttp://a.example\"\"\"\njobs = 2\n",
+			key:     "server",
+			value:   "http://b.example",
+			want:    "server = \"http://b.example\"\njobs = 2\n",
+		},
+		{
+			name: "multi-line array",
+			content: `hosts = [
+  "a", # first
+  "b",
+]
+jobs = 2
+`,
+			key:   "chunk_jobs",
+			value: "3",
+			want: `hosts = [
+  "a", # first
+  "b",
+]
+jobs = 2
+chunk_jobs = 3
+`,
+		},
+		{
+			name:    "quoted key",
+			content: "\"jobs\" = 2\n",
+			key:     "jobs",
+			value:   "5",
+			want:    "\"jobs\" = 5\n",
+		},
+		{
+			name:    "dotted key",
+			content: "server = \"http://a.example\"\nprofiles.dev.server = \"http://dev.example\"\n",
+			key:     "profiles.dev.server",
+			value:   "http://dev2.example",
+			want:    "server = \"http://a.example\"\nprofiles.dev.server = \"http://dev2.example\"\n",
+		},
+		{
+			name:    "quoted table name",
+			content: "[profiles.\"my server\"]\nserver = \"http://a.example\" # old\n",
+			key:     "profiles.my server.server",
+			value:   "http://b.example",
+			want:    "[profiles.\"my server\"]\nserver = \"http://b.example\" # old\n",
+		},
+		{
+			name: "key added to an existing table",
+			content: `[profiles.prod]
+# production
+server = "http://prod.example"
+
+[profiles.staging]
+server = "http://staging.example"
+`,
+			key:   "profiles.prod.server",
+			value: "http://prod2.example",
+			want: `[profiles.prod]
+# production
+server = "http://prod2.example"
+
+[profiles.staging]
+server = "http://staging.example"
+`,
+		},
+		{
+			name:    "new profile table",
+			content: "server = \"http://a.example\"\n\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+			key:     "profiles.x.server",
+			value:   "http://x.example",
+			want:    "server = \"http://a.example\"\n\n[profiles.prod]\nserver = \"http://prod.example\"\n\n[profiles.x]\nserver = \"http://x.example\"\n",
+		},
+		{
+			name:    "new profile table with a dot in its name",
+			content: "jobs = 2\n",
+			key:     "profiles.eu.west.server",
+			value:   "http://eu.example",
+			want:    "jobs = 2\n\n[profiles.\"eu.west\"]\nserver = \"http://eu.example\"\n",
+		},
+		{
+			name:    "empty table gets the key",
+			content: "[profiles.x]\n\n[profiles.y]\nserver = \"http://y.example\"\n",
+			key:     "profiles.x.server",
+			value:   "http://x.example",
+			want:    "[profiles.x]\nserver = \"http://x.example\"\n\n[profiles.y]\nserver = \"http://y.example\"\n",
+		},
+		{
+			name:    "CRLF line endings",
+			content: "server = \"http://a.example\"\r\njobs = 2\r\n",
+			key:     "jobs",
+			value:   "3",
+			want:    "server = \"http://a.example\"\njobs = 3\n",
+		},
+		{
+			name:    "refuses a result that does not parse",
+			content: "profiles = \"none\"\n",
+			key:     "profiles.x.server",
+			value:   "http://x.example",
+			wantErr: "refusing to write invalid config file",
+		},
+		{
+			name:    "refuses to rewrite an invalid file",
+			content: "server = \"http://a.example\"\njobs = \n",
+			key:     "server",
+			value:   "http://b.example",
+			wantErr: "refusing to write invalid config file",
+		},
+		{name: "unknown key", content: "jobs = 2\n", key: "token", value: "x", wantErr: `unknown config key "token"`},
+		{name: "invalid url", content: "jobs = 2\n", key: "server", value: "ftp://a", wantErr: "is not an http(s) URL"},
+		{name: "invalid integer", content: "jobs = 2\n", key: "jobs", value: "0", wantErr: "is not a positive integer"},
+		{name: "invalid repo name", content: "jobs = 2\n", key: "repo", value: "a/b", wantErr: "must not contain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), ".hfile", "config.toml")
+			writeTestConfig(t, configPath, tt.content)
+
+			err := SetValue(configPath, tt.key, tt.value)
+			got, _ := os.ReadFile(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SetValue error = %v, want %q", err, tt.wantErr)
+				}
+				if string(got) != tt.content {
+					t.Errorf("file changed after a failed edit:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetValue: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("config file =\n%s\nwant\n%s", got, tt.want)
+			}
+			if value, ok, err := GetValue(configPath, tt.key); err != nil || !ok || value != tt.value {
+				t.Errorf("GetValue(%s) = %q, %v, %v, want %q", tt.key, value, ok, err, tt.value)
+			}
+		})
+	}
+}
+
+func TestUnsetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		want    string
+		removed bool
+	}{
+		{
+			name:    "keeps comments and other keys",
+			content: "# hfile config\nserver = \"http://a.example\" # main\njobs = 2\n",
+			key:     "jobs",
+			want:    "# hfile config\nserver = \"http://a.example\" # main\n",
+			removed: true,
+		},
+		{
+			name:    "last key in a table",
+			content: "server = \"http://a.example\"\n\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+			key:     "profiles.prod.server",
+			want:    "server = \"http://a.example\"\n\n[profiles.prod]\n",
+			removed: true,
+		},
+		{
+			name:    "same key in another table is kept",
+			content: "server = \"http://a.example\"\n\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+			key:     "server",
+			want:    "\n[profiles.prod]\nserver = \"http://prod.example\"\n",
+			removed: true,
+		},
+		{
+			name:    "multi-line value",
+			content: "server = \"\"\"\nhttp://a.example\"\"\"\njobs = 2\n",
+			key:     "server",
+			want:    "jobs = 2\n",
+			removed: true,
+		},
+		{
+			name:    "dotted key",
+			content: "profiles.dev.server = \"http://dev.example\"\njobs = 2\n",
+			key:     "profiles.dev.server",
+			want:    "jobs = 2\n",
+			removed: true,
+		},
+		{
+			name:    "key only inside a multi-line string",
+			content: "note = \"\"\"\njobs = 2\n\"\"\"\n",
+			key:     "jobs",
+			want:    "note = \"\"\"\njobs = 2\n\"\"\"\n",
+		},
+		{
+			name:    "key not set",
+			content: "server = \"http://a.example\"\n",
+			key:     "jobs",
+			want:    "server = \"http://a.example\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), ".hfile", "config.toml")
+			writeTestConfig(t, configPath, tt.content)
+
+			removed, err := UnsetValue(configPath, tt.key)
+			if err != nil {
+				t.Fatalf("UnsetValue: %v", err)
+			}
+			if removed != tt.removed {
+				t.Errorf("removed = %v, want %v", removed, tt.removed)
+			}
+			got, _ := os.ReadFile(configPath)
+			if string(got) != tt.want {
+				t.Errorf("config file =\n%s\nwant\n%s", got, tt.want)
+			}
+			if _, ok, _ := GetValue(configPath, tt.key); ok {
+				t.Errorf("%s still set after unset", tt.key)
+			}
+		})
+	}
+
+	removed, err := UnsetValue(filepath.Join(t.TempDir(), "missing.toml"), "jobs")
+	if err != nil || removed {
+		t.Errorf("UnsetValue on a missing file = %v, %v, want false, nil", removed, err)
+	}
+}
+
+func TestSetValueKeepsPermissions(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeTestConfig(t, configPath, "jobs = 2\n")
+	if err := os.Chmod(configPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetValue(configPath, "jobs", "3"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("mode = %v after edit, want 0600", perm)
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// 覆盖配置文件的环境变量，优先级：命令行参数 > 环境变量 > 仓库配置 > 用户主目录配置 > 默认值
+const (
+	EnvServer       = "HFILE_SERVER"
+	EnvProfile      = "HFILE_PROFILE"
+	EnvToken        = "HFILE_TOKEN"
+	EnvRefreshToken = "HFILE_REFRESH_TOKEN"
+	EnvRepo         = "HFILE_REPO"
+	EnvJobs         = "HFILE_JOBS"
+	EnvChunkSize    = "HFILE_CHUNK_SIZE"
+	EnvChunkJobs    = "HFILE_CHUNK_JOBS"
+
+	EnvRetryAttempts  = "HFILE_RETRY_ATTEMPTS"
+	EnvRetryBaseDelay = "HFILE_RETRY_BASE_DELAY"
+	EnvRetryMaxDelay  = "HFILE_RETRY_MAX_DELAY"
+	EnvRetryJitter    = "HFILE_RETRY_JITTER"
+)
+
+// 配置值的来源，配置文件来源直接使用文件路径
+const (
+	SourceDefault = "default"
+	SourceDirName = "directory name"
+)
+
+// Setting 是一个生效的配置值及其来源
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// TokenFromEnv reports whether the token is supplied by HFILE_TOKEN
+func TokenFromEnv() bool {
+	return os.Getenv(EnvToken) != ""
+}
+
+// LoadRepo returns the remote repository name for the repository at root:
+// HFILE_REPO > repo in .hfile/config.toml > directory name
+func LoadRepo(root string) (string, string) {
+	if repo := os.Getenv(EnvRepo); repo != "" {
+		return repo, envSource(EnvRepo)
+	}
+	configPath := LocalConfigPath(root)
+	if cfg, err := readConfigFile(configPath); err == nil && cfg.Repo != "" {
+		return cfg.Repo, configPath
+	}
+	return filepath.Base(root), SourceDirName
+}
+
+// envSource describes a value that came from an environment variable
+func envSource(name string) string {
+	return "env " + name
+}
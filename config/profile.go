@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Profile 是 config.toml 中的一个命名服务器配置：
+//
+//	[profiles.staging]
+//	server = "https://staging.example.com"
+type Profile struct {
+	Server string `toml:"server"`
+}
+
+// activeProfile 是本次运行使用的 profile，为空时使用 config.toml 顶层的 server
+var activeProfile string
+
+// profileFromFlag 表示 activeProfile 由 --profile 参数指定，此时 profile 的服务器优先于 HFILE_SERVER
+var profileFromFlag bool
+
+// SetActiveProfile selects the profile used by LoadConfig and the token functions.
+// fromFlag reports whether the profile was given with --profile.
+func SetActiveProfile(name string, fromFlag bool) {
+	activeProfile = name
+	profileFromFlag = name != "" && fromFlag
+}
+
+// ActiveProfile returns the profile selected by SetActiveProfile
+func ActiveProfile() string {
+	return activeProfile
+}
+
+// ResolveProfile picks the profile with priority: flag > HFILE_PROFILE > repo dir config > home dir config.
+// The home dir profile is ignored when the repo dir config sets server or profile.
+// It returns an empty name when no profile is selected and an error when the selected profile is not defined.
+func ResolveProfile(repoDir, flagValue string) (string, error) {
+	name, _, err := ResolveProfileSource(repoDir, flagValue)
+	return name, err
+}
+
+// ResolveProfileSource resolves the profile like ResolveProfile and also describes where it came from
+func ResolveProfileSource(repoDir, flagValue string) (string, string, error) {
+	name, source := flagValue, "flag --profile"
+	if name == "" {
+		name, source = os.Getenv(EnvProfile), envSource(EnvProfile)
+	}
+	if name == "" {
+		name, source = configProfile(repoDir)
+	}
+	if name == "" {
+		return "", SourceDefault, nil
+	}
+
+	if _, ok := LoadProfiles(repoDir)[name]; !ok {
+		return "", source, fmt.Errorf("profile %q is not defined in any config file", name)
+	}
+	return name, source, nil
+}
+
+// configProfile returns the profile set in the config files and the file it came from.
+// 仓库配置设置了 server 时不再使用用户主目录配置的 profile，保证仓库总是同步到它自己的服务器。
+func configProfile(repoDir string) (string, string) {
+	for _, configPath := range configFilePaths(repoDir) {
+		cfg, err := readConfigFile(configPath)
+		if err != nil {
+			continue
+		}
+		if cfg.Profile != "" {
+			return cfg.Profile, configPath
+		}
+		if cfg.Server != "" {
+			break
+		}
+	}
+	return "", SourceDefault
+}
+
+// LoadProfiles returns the profiles defined in the home dir and repo dir config, repo dir wins on conflicts
+func LoadProfiles(repoDir string) map[string]Profile {
+	profiles := make(map[string]Profile)
+	var paths []string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(homeDir, ".hfile", "config.toml"))
+	}
+	paths = append(paths, filepath.Join(repoDir, ".hfile", "config.toml"))
+
+	for _, configPath := range paths {
+		cfg, err := readConfigFile(configPath)
+		if err != nil {
+			continue
+		}
+		for name, profile := range cfg.Profiles {
+			profiles[name] = profile
+		}
+	}
+	return profiles
+}
+
+// UseProfile sets the default profile of the repository and returns the config file written
+func UseProfile(repoDir, name string) (string, error) {
+	if _, ok := LoadProfiles(repoDir)[name]; !ok {
+		return "", fmt.Errorf("profile %q is not defined in any config file", name)
+	}
+
+	configPath := LocalConfigPath(repoDir)
+	if err := SetValue(configPath, "profile", name); err != nil {
+		return "", err
+	}
+	return configPath, nil
+}
+
+// profileServer returns the server URL of the active profile
+func profileServer(repoDir string) (string, error) {
+	profile, ok := LoadProfiles(repoDir)[activeProfile]
+	if !ok {
+		return "", fmt.Errorf("profile %q is not defined in any config file", activeProfile)
+	}
+	if profile.Server == "" {
+		return "", fmt.Errorf("server not set for profile %q", activeProfile)
+	}
+	return profile.Server, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupConfigDirs 创建临时的用户主目录和仓库目录并写入两者的 config.toml，
+// 同时清空会影响配置的环境变量。内容为空时不创建对应文件。
+func setupConfigDirs(t *testing.T, homeConfig, repoConfig string) string {
+	t.Helper()
+	home := t.TempDir()
+	repo := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for _, env := range []string{EnvServer, EnvProfile, EnvToken, EnvRefreshToken, EnvRepo, EnvJobs, EnvChunkSize, EnvChunkJobs} {
+		t.Setenv(env, "")
+	}
+	SetActiveProfile("", false)
+	t.Cleanup(func() { SetActiveProfile("", false) })
+
+	writeTestConfig(t, filepath.Join(home, ".hfile", "config.toml"), homeConfig)
+	writeTestConfig(t, LocalConfigPath(repo), repoConfig)
+	return repo
+}
+
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if content == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHomeProfileDoesNotOverrideRepoServer(t *testing.T) {
+	repo := setupConfigDirs(t,
+		"profile = \"prod\"\n[profiles.prod]\nserver = \"http://prod.example:2\"\n",
+		"server = \"http://repo.example:1\"\n")
+
+	profile, source, err := ResolveProfileSource(repo, "")
+	if err != nil {
+		t.Fatalf("ResolveProfileSource: %v", err)
+	}
+	if profile != "" || source != SourceDefault {
+		t.Fatalf("profile = %q from %q, want none", profile, source)
+	}
+
+	SetActiveProfile(profile, false)
+	server, source, err := LoadServerSource(repo)
+	if err != nil {
+		t.Fatalf("LoadServerSource: %v", err)
+	}
+	if server != "http://repo.example:1" || source != LocalConfigPath(repo) {
+		t.Errorf("server = %q from %q, want http://repo.example:1 from %s", server, source, LocalConfigPath(repo))
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// durationSettings 是时长配置项对应的环境变量和配置字段
+var durationSettings = map[string]struct {
+	env string
+	get func(Config) string
+}{
+	"retry_base_delay": {EnvRetryBaseDelay, func(cfg Config) string { return cfg.RetryBaseDelay }},
+	"retry_max_delay":  {EnvRetryMaxDelay, func(cfg Config) string { return cfg.RetryMaxDelay }},
+}
+
+// LoadDurationSource loads a duration setting (retry_base_delay or retry_max_delay) with priority:
+// environment variable > repo dir > ~/.hfile/config.toml, 0 means default
+func LoadDurationSource(repoDir, key string) (time.Duration, string) {
+	setting, ok := durationSettings[key]
+	if !ok {
+		return 0, SourceDefault
+	}
+	if value := os.Getenv(setting.env); value != "" {
+		if d, err := parseDuration(value); err == nil {
+			return d, envSource(setting.env)
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ Ignoring %s=%q: not a positive duration\n", setting.env, value)
+	}
+
+	for _, configPath := range configFilePaths(repoDir) {
+		cfg, err := readConfigFile(configPath)
+		if err != nil || setting.get(cfg) == "" {
+			continue
+		}
+		d, err := parseDuration(setting.get(cfg))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ Ignoring %s in %s: %v\n", key, configPath, err)
+			continue
+		}
+		return d, configPath
+	}
+	return 0, SourceDefault
+}
+
+// LoadRetryJitter loads retry_jitter, the fraction by which retry delays are randomized.
+// ok is false when it is not set, since 0 is a valid value that disables jitter.
+func LoadRetryJitter(repoDir string) (jitter float64, source string, ok bool) {
+	if value := os.Getenv(EnvRetryJitter); value != "" {
+		if r, err := parseRatio(value); err == nil {
+			return r, envSource(EnvRetryJitter), true
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ Ignoring %s=%q: not a number between 0 and 1\n", EnvRetryJitter, value)
+	}
+
+	for _, configPath := range configFilePaths(repoDir) {
+		cfg, err := readConfigFile(configPath)
+		if err != nil || cfg.RetryJitter == nil {
+			continue
+		}
+		if r := *cfg.RetryJitter; r >= 0 && r <= 1 {
+			return r, configPath, true
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ Ignoring retry_jitter in %s: not a number between 0 and 1\n", configPath)
+	}
+	return 0, SourceDefault, false
+}
+
+// parseDuration parses a positive Go duration such as "500ms" or "30s"
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%q is not a positive duration such as 500ms or 30s", value)
+	}
+	return d, nil
+}
+
+// parseRatio parses a number between 0 and 1
+func parseRatio(value string) (float64, error) {
+	r, err := strconv.ParseFloat(value, 64)
+	if err != nil || r < 0 || r > 1 {
+		return 0, fmt.Errorf("%q is not a number between 0 and 1", value)
+	}
+	return r, nil
+}
@@ -1,389 +1,1315 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/BurntSushi/toml"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/litongjava/hfile/cli"
 	"github.com/litongjava/hfile/client"
 	"github.com/litongjava/hfile/config"
 	constant "github.com/litongjava/hfile/const"
+	"github.com/litongjava/hfile/model"
+	"github.com/litongjava/hfile/server"
 	"github.com/litongjava/hfile/utils"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 )
 
-const (
-	RegisterPath = "/api/v1/register"
-	LoginPath    = "/api/v1/login"
-	ProfilePath  = "/api/v1/user/profile"
-	RepoListPath = "/repo/list"
-)
+// rootCtx 在收到 Ctrl-C 或 SIGTERM 时取消，所有请求和传输都使用它
+var rootCtx = context.Background()
+
+// exitInterrupted 是传输被 Ctrl-C 中断时的退出码
+const exitInterrupted = 130
 
 func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	rootCtx = ctx
+	go func() {
+		<-ctx.Done()
+		// 恢复默认的信号处理，再按一次 Ctrl-C 立即退出
+		stop()
+		fmt.Fprintln(os.Stderr, "⚠️ Interrupted, stopping (press Ctrl-C again to quit now)")
+	}()
+
+	code := newApp().Run(os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// syncOptions 是 push/pull 的可选参数
+type syncOptions struct {
+	strategy client.ConflictStrategy
+	jobs     int
+	rehash   bool
+}
+
+// resolveJobs 确定并发数：命令行参数 > 环境变量 > 配置文件 > 默认值
+func resolveJobs(repoDir string, opts syncOptions) int {
+	if opts.jobs > 0 {
+		return opts.jobs
+	}
+	if jobs := config.LoadJobs(repoDir); jobs > 0 {
+		return jobs
+	}
+	return client.DefaultJobs
+}
+
+// loadRetryPolicy 读取配置的重试策略，未配置的字段使用默认值
+func loadRetryPolicy(repoDir string) client.RetryPolicy {
+	policy := client.DefaultRetryPolicy()
+	if attempts, _ := config.LoadIntSource(repoDir, "retry_attempts"); attempts > 0 {
+		policy.MaxAttempts = int(attempts)
 	}
+	if delay, _ := config.LoadDurationSource(repoDir, "retry_base_delay"); delay > 0 {
+		policy.BaseDelay = delay
+	}
+	if delay, _ := config.LoadDurationSource(repoDir, "retry_max_delay"); delay > 0 {
+		policy.MaxDelay = delay
+	}
+	if jitter, _, ok := config.LoadRetryJitter(repoDir); ok {
+		policy.Jitter = jitter
+	}
+	return policy
+}
 
-	cmd := os.Args[1]
+// retryCounts 记录每个传输任务的重试次数，用于输出汇总
+var retryCounts = struct {
+	sync.Mutex
+	byPath map[string]int
+}{byPath: make(map[string]int)}
 
-	// 处理 config 子命令
-	if cmd == "config" {
-		if len(os.Args) < 3 {
-			fmt.Println("❌Missing config subcommand")
-			printConfigUsage()
-			os.Exit(1)
-		}
+// reportRetry 记录一次重试。ndjson 模式下输出 retry 事件，--verbose 时输出一行提示
+func reportRetry(ctx context.Context, event client.RetryEvent) {
+	task, inTask := client.TransferTaskFromContext(ctx)
+	if inTask {
+		retryCounts.Lock()
+		retryCounts.byPath[task.Path]++
+		retryCounts.Unlock()
+	}
 
-		subCmd := os.Args[2]
-		switch subCmd {
-		case "list":
-			repoDir := os.Args[2]
-			if repoDir == "" {
-				repoDir = "."
+	if globals.output == outputNDJSON && inTask {
+		printJSON(model.TransferEvent{
+			SchemaVersion: model.OutputSchemaVersion,
+			Event:         "retry",
+			Kind:          string(task.Kind),
+			Path:          task.Path,
+			Error:         event.Err.Error(),
+			Attempt:       event.Attempt,
+			DelayMs:       event.Delay.Milliseconds(),
+		})
+		return
+	}
+	if !globals.verbose {
+		return
+	}
+	msg := fmt.Sprintf("🔁 Retrying %s (attempt %d/%d) in %v: %v\n",
+		event.Op, event.Attempt, event.MaxAttempts, event.Delay.Round(time.Millisecond), event.Err)
+	if textOutput() {
+		fmt.Print(msg)
+	} else {
+		fmt.Fprint(os.Stderr, msg)
+	}
+}
+
+// newTransferScheduler 创建输出传输进度的调度器，ndjson 模式下每个事件输出一行
+func newTransferScheduler(jobs int) *client.TransferScheduler {
+	return &client.TransferScheduler{
+		Jobs: jobs,
+		OnStart: func(task client.TransferTask) {
+			switch globals.output {
+			case outputNDJSON:
+				printJSON(model.TransferEvent{
+					SchemaVersion: model.OutputSchemaVersion,
+					Event:         "start",
+					Kind:          string(task.Kind),
+					Path:          task.Path,
+				})
+				return
+			case outputJSON:
+				return
 			}
-			config.ListConfigs(repoDir)
-			return
-		default:
-			fmt.Printf("❌ Invalid config subcommand: %s\n", subCmd)
-			printConfigUsage()
-			os.Exit(1)
-		}
+			switch task.Kind {
+			case client.TransferUpload:
+				fmt.Printf("📤 Uploading: %s\n", task.Path)
+			case client.TransferDownload:
+				fmt.Printf("📥 Downloading: %s\n", task.Path)
+			case client.TransferDeleteRemote:
+				fmt.Printf("🗑️ Deleting remote: %s\n", task.Path)
+			case client.TransferDeleteLocal:
+				fmt.Printf("🗑️ Deleting local: %s\n", task.Path)
+			}
+		},
+		OnDone: func(result client.TransferResult) {
+			switch globals.output {
+			case outputNDJSON:
+				r := transferResult(result)
+				printJSON(model.TransferEvent{
+					SchemaVersion: model.OutputSchemaVersion,
+					Event:         "done",
+					Kind:          r.Kind,
+					Path:          r.Path,
+					Status:        r.Status,
+					Error:         r.Error,
+				})
+				return
+			case outputJSON:
+				return
+			}
+			if result.Cancelled {
+				fmt.Printf("⏸️ %s interrupted: %s\n", result.Task.Kind, result.Task.Path)
+				return
+			}
+			if result.Err != nil {
+				fmt.Printf("❌ %s failed for %s: %v\n", result.Task.Kind, result.Task.Path, result.Err)
+				return
+			}
+			switch result.Task.Kind {
+			case client.TransferUpload:
+				fmt.Printf("✅ Uploaded: %s\n", result.Task.Path)
+			case client.TransferDownload:
+				fmt.Printf("✅ Downloaded: %s\n", result.Task.Path)
+			case client.TransferDeleteRemote:
+				fmt.Printf("✅ Deleted remote: %s\n", result.Task.Path)
+			case client.TransferDeleteLocal:
+				fmt.Printf("✅ Deleted local: %s\n", result.Task.Path)
+			}
+		},
 	}
+}
+
+func transferResult(result client.TransferResult) model.TransferResult {
+	retryCounts.Lock()
+	retries := retryCounts.byPath[result.Task.Path]
+	retryCounts.Unlock()
 
-	if cmd == "repo" {
-		if len(os.Args) < 3 {
-			fmt.Println("❌ Missing repo subcommand")
-			printConfigUsage()
-			os.Exit(1)
+	r := model.TransferResult{
+		Kind:    string(result.Task.Kind),
+		Path:    result.Task.Path,
+		Status:  "ok",
+		Retries: retries,
+	}
+	if result.Err != nil {
+		r.Status = "failed"
+		if result.Cancelled {
+			r.Status = "interrupted"
 		}
+		r.Error = result.Err.Error()
+	}
+	return r
+}
 
-		subCmd := os.Args[2]
-		switch subCmd {
-		case "list":
-			var repoDir = "."
-			if len(os.Args) > 3 {
-				repoDir = os.Args[3]
-			}
-			handleListRepos(repoDir)
-			return
-		default:
-			fmt.Printf("❌ Invalid config subcommand: %s\n", subCmd)
-			printConfigUsage()
-			os.Exit(1)
-		}
-	}
-
-	// 处理其他主命令
-	repoDir := "."
-	if len(os.Args) > 3 {
-		repoDir = os.Args[2]
-	}
-
-	switch cmd {
-	case "init":
-		handleInit()
-	case "init-local":
-		handleInitLocal(repoDir)
-	case "register":
-		handleRegister(repoDir)
-	case "login":
-		repoDir := os.Args[4]
-		if repoDir == "" {
-			repoDir = "."
-		}
-		handleLogin(repoDir)
-	case "profile":
-		handleProfile(repoDir)
-	case "push":
-		handlePush(repoDir)
-	case "pull":
-		handlePull(repoDir)
-	case "status":
-		handleStatus(repoDir)
-	default:
-		fmt.Println("❌ 无效命令:", cmd)
-		printUsage()
-		os.Exit(1)
+// transferExitCode 返回传输未全部成功时的退出码
+func transferExitCode(summary client.TransferSummary) int {
+	if summary.Interrupted() {
+		return exitInterrupted
 	}
+	return cli.ExitFailure
 }
 
-func printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  hfile init [server_url]          # 初始化用户主目录配置文件")
-	fmt.Println("  hfile init-local [server_url]    # 初始化当前目录配置文件")
-	fmt.Println("  hfile config list                # 显示所有配置信息")
-	fmt.Println("  hfile repo list                # show all repository")
-	fmt.Println("  hfile register <email> <password>       # 注册用户")
-	fmt.Println("  hfile login <email> <password>          # 用户登录")
-	fmt.Println("  hfile push                       # 推送本地变更到远程")
-	fmt.Println("  hfile pull                       # 拉取远程变更到本地")
-	fmt.Println("  hfile status                     # 显示待上传/下载的文件")
-	fmt.Printf("  默认服务器地址: %s\n", constant.ServerURL)
+// reportTransfers 输出传输汇总和未解决的冲突，返回是否全部成功
+func reportTransfers(command string, summary client.TransferSummary, conflicts []model.StatusEntry) bool {
+	ok := len(summary.Failed) == 0 && len(conflicts) == 0 && !summary.Interrupted()
+
+	if !textOutput() {
+		report := model.TransferReport{
+			SchemaVersion: model.OutputSchemaVersion,
+			Command:       command,
+			Succeeded:     len(summary.Succeeded),
+			Failed:        len(summary.Failed),
+			Interrupted:   len(summary.Cancelled),
+			Skipped:       len(summary.Skipped),
+			Results:       []model.TransferResult{},
+			Conflicts:     conflicts,
+		}
+		if globals.output == outputNDJSON {
+			report.Event = "summary"
+		}
+		for _, result := range summary.Succeeded {
+			report.Results = append(report.Results, transferResult(result))
+		}
+		for _, result := range summary.Failed {
+			report.Results = append(report.Results, transferResult(result))
+		}
+		for _, result := range summary.Cancelled {
+			report.Results = append(report.Results, transferResult(result))
+		}
+		for _, task := range summary.Skipped {
+			report.Results = append(report.Results, model.TransferResult{Kind: string(task.Kind), Path: task.Path, Status: "skipped"})
+		}
+		if report.Conflicts == nil {
+			report.Conflicts = []model.StatusEntry{}
+		}
+		printJSON(report)
+		return ok
+	}
+
+	if len(summary.Succeeded) > 0 || len(summary.Failed) > 0 || summary.Interrupted() {
+		fmt.Printf("📊 %d succeeded, %d failed\n", len(summary.Succeeded), len(summary.Failed))
+		for _, result := range summary.Failed {
+			fmt.Printf("  ✗ %s %s: %v\n", result.Task.Kind, result.Task.Path, result.Err)
+		}
+	}
+	if summary.Interrupted() {
+		fmt.Printf("⏸️ Interrupted: %d in progress, %d not started\n", len(summary.Cancelled), len(summary.Skipped))
+		// clone 的目录已存在，由调用方提示用 pull 继续
+		if command != "clone" {
+			fmt.Printf("Run 'hfile %s' again to resume, partial uploads and downloads are kept.\n", command)
+		}
+	}
+	if len(conflicts) > 0 {
+		if command == "push" {
+			fmt.Printf("❌ %d conflict(s) skipped. Use --force-local to overwrite the remote versions.\n", len(conflicts))
+		} else {
+			fmt.Printf("❌ %d conflict(s) left unresolved. Use --force-local or --force-remote to choose a side.\n", len(conflicts))
+		}
+	}
+	return ok
 }
 
-func printConfigUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  hfile config list                # 显示所有配置信息")
+// conflictEntries 返回仍未解决的冲突
+func conflictEntries(conflicts []model.FileMeta, local, remote map[string]model.FileMeta, base map[string]model.SyncEntry) []model.StatusEntry {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	unresolved := make(map[string]bool, len(conflicts))
+	for _, file := range conflicts {
+		unresolved[file.Path] = true
+	}
+	var entries []model.StatusEntry
+	for _, entry := range client.BuildStatus(local, remote, base) {
+		if unresolved[entry.Path] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
 }
 
-func handleInit() {
-	var serverURL string
-	if len(os.Args) > 2 {
-		serverURL = os.Args[2]
+// succeededPaths 返回成功处理的路径，用于更新同步状态
+func succeededPaths(summary client.TransferSummary) map[string]bool {
+	done := make(map[string]bool)
+	for _, result := range summary.Succeeded {
+		done[result.Task.Path] = true
 	}
+	return done
+}
 
+func handleInit(serverURL string) error {
 	if err := config.InitConfig(serverURL); err != nil {
-		fmt.Printf("❌ Failed: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
 	}
 	err := os.Mkdir(".hfile", 755)
 	if err != nil {
 		hlog.Error("Failed:", err.Error())
 	}
+	return nil
 }
 
-func handleInitLocal(repoDir string) {
-	var serverURL string
-	if len(os.Args) > 2 {
-		serverURL = os.Args[2]
-	}
-
+// handleInitLocal 创建或更新仓库配置，记录服务器地址和远程仓库名。
+// repo 为空时保留已有的仓库名，没有时使用目录名。
+func handleInitLocal(repoDir, serverURL, repo string) error {
 	// 设置默认服务器地址
 	if serverURL == "" {
 		serverURL = constant.ServerURL
 	}
 
-	localConfig := config.Config{
-		Server: serverURL,
+	// 创建或更新当前目录的配置文件，保留已有的其它配置
+	configFilePath := config.LocalConfigPath(repoDir)
+	if err := config.SetValue(configFilePath, "server", serverURL); err != nil {
+		return fmt.Errorf("Failed: %w", err)
 	}
 
-	// 创建当前目录的配置文件
-	configDir := filepath.Join(repoDir, ".hfile")
-	os.Mkdir(configDir, 755)
-	configFilePath := filepath.Join(configDir, "config.toml")
-	file, err := os.Create(configFilePath)
-	if err != nil {
-		fmt.Printf("❌ Failed: %v\n", err)
-		os.Exit(1)
+	if repo == "" {
+		if existing, ok, _ := config.GetValue(configFilePath, "repo"); ok {
+			repo = existing
+		} else if abs, err := filepath.Abs(repoDir); err == nil {
+			repo = filepath.Base(abs)
+		}
 	}
-	defer file.Close()
-
-	// 写入配置
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(localConfig); err != nil {
-		fmt.Printf("❌ Failed: %v\n", err)
-		os.Exit(1)
+	if err := config.SetValue(configFilePath, "repo", repo); err != nil {
+		return fmt.Errorf("Failed: %w", err)
 	}
 
 	fmt.Printf("✅ created: %s\n", configFilePath)
 	fmt.Printf("server url: %s\n", serverURL)
+	fmt.Printf("repo: %s\n", repo)
+	return nil
+}
+
+// loadClient 返回使用 serverURL 已保存 token 的客户端，未登录时返回以 notLoggedIn 为信息的错误
+func loadClient(repoDir, serverURL, notLoggedIn string) (*client.Client, *savedTokens, error) {
+	tokens, err := loadSavedTokens(serverURL)
+	if err != nil {
+		return nil, nil, errors.New(notLoggedIn)
+	}
+	c := client.New(serverURL, tokens)
+	c.Retry = loadRetryPolicy(repoDir)
+	c.OnRetry = reportRetry
+	return c, tokens, nil
 }
 
-func handleRegister(repoDir string) {
-	if len(os.Args) < 4 {
-		fmt.Println("❌ 缺少参数。用法: hfile register <username> <password>")
-		os.Exit(1)
+func handleRegister(repoDir, username, password string) error {
+	serverURL, err := loadServerURL(repoDir)
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
 	}
 
-	username := os.Args[2]
-	password := os.Args[3]
+	fmt.Printf("🔧 server url: %s\n", serverURL)
+	err = client.New(serverURL, nil).Register(rootCtx, username, password)
+	if err == nil {
+		fmt.Println("✅ Successfully!")
+		return nil
+	}
+	fmt.Println("❌ Failed:", err)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		for _, field := range apiErr.Fields {
+			fmt.Println("error:", field.Field, " ", field.Messages)
+		}
+	}
+	return &cli.ExitError{Code: cli.ExitFailure}
+}
 
-	serverURL, err := config.LoadConfig(repoDir)
+func handleLogin(repoDir, username, password string) error {
+	serverURL, err := loadServerURL(repoDir)
 	if err != nil {
-		fmt.Println("❌ 加载配置失败:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
 	}
 
 	fmt.Printf("🔧 server url: %s\n", serverURL)
-	client.Register(serverURL+RegisterPath, username, password)
+	tokens, err := client.New(serverURL, nil).Login(rootCtx, username, password)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	fmt.Println("✅ Successfully!")
+
+	// 保存 token 到配置文件
+	path, err := config.SaveToken(serverURL, tokens.Token, tokens.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("Failed to save token: %w", err)
+	}
+	fmt.Printf("✅ Token saved to: %s\n", path)
+	return nil
 }
 
-func handleLogin(repoDir string) {
-	if len(os.Args) < 4 {
-		fmt.Println("❌ 缺少参数。用法: hfile login <email> <password>")
-		os.Exit(1)
+func handleProfile(repoDir string) error {
+	serverURL, err := loadServerURL(repoDir)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	c, _, err := loadClient(repoDir, serverURL, "not found token，please login first")
+	if err != nil {
+		return err
 	}
 
-	username := os.Args[2]
-	password := os.Args[3]
+	profile, err := c.Profile(rootCtx)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if textOutput() {
+		data, err := json.MarshalIndent(profile, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+		fmt.Println("✅ Successfully!")
+		fmt.Println(string(data))
+		return nil
+	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"profile":        profile,
+	})
+	return nil
+}
 
-	serverURL, err := config.LoadConfig(repoDir)
+func handleTokenRefresh(repoDir string) error {
+	serverURL, err := loadServerURL(repoDir)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
 	}
 
-	fmt.Printf("🔧 server url: %s\n", serverURL)
-	client.Login(serverURL+LoginPath, username, password)
+	c, tokens, err := loadClient(repoDir, serverURL, "not found token，please login first")
+	if err != nil {
+		return err
+	}
+	_, err = tokens.Refresh(rootCtx, c, "")
+	path := tokens.SavedTo()
+	if err != nil {
+		return fmt.Errorf("Failed to refresh token: %w", err)
+	}
+	if textOutput() {
+		if path == "" {
+			fmt.Printf("✅ Token refreshed for this process only, %s is not updated\n", config.EnvToken)
+			return nil
+		}
+		fmt.Printf("✅ Token refreshed, saved to: %s\n", path)
+		return nil
+	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"saved_to":       path,
+	})
+	return nil
+}
+
+// handleLogout 在服务器端注销 token，并从凭证文件中清除 token。
+// all 为 true 时注销并清除所有服务器和 profile 的 token。
+func handleLogout(repoDir string, all bool) error {
+	var targets []config.SavedToken
+	if all {
+		saved, err := config.SavedTokens()
+		if err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+		targets = saved
+	} else {
+		serverURL, err := loadServerURL(repoDir)
+		if err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+		token, refresh, err := config.LoadToken(serverURL)
+		if err != nil {
+			return errors.New("not found token，already logged out")
+		}
+		targets = []config.SavedToken{{Profile: config.ActiveProfile(), Server: serverURL, Token: token, RefreshToken: refresh}}
+	}
+
+	var cleared []string
+	for _, target := range targets {
+		if target.Token != "" && target.Server != "" {
+			c := client.New(target.Server, client.StaticToken(target.Token))
+			if err := c.Logout(rootCtx, target.RefreshToken); err == client.ErrLogoutUnsupported {
+				hlog.Debugf("server %s does not support logout, clearing token locally", target.Server)
+			} else if err != nil {
+				warn("Server-side logout failed:", err)
+			}
+		}
+		name := target.Server
+		if target.Profile != "" {
+			name = fmt.Sprintf("%s (profile %s)", target.Server, target.Profile)
+		}
+		cleared = append(cleared, name)
+	}
+
+	if all {
+		if err := config.ClearAllTokens(); err != nil {
+			return fmt.Errorf("Failed to clear tokens: %w", err)
+		}
+	} else if _, err := config.ClearToken(targets[0].Server); err != nil {
+		return fmt.Errorf("Failed to clear token for %s: %w", targets[0].Server, err)
+	}
+
+	if !textOutput() {
+		printJSON(map[string]interface{}{
+			"schema_version": model.OutputSchemaVersion,
+			"cleared":        cleared,
+		})
+		return nil
+	}
+	if len(cleared) == 0 {
+		fmt.Println("✅ No token saved, nothing to clear")
+		return nil
+	}
+	for _, name := range cleared {
+		fmt.Printf("✅ Logged out from: %s\n", name)
+	}
+	return nil
+}
+
+// handleRemoteRename 修改仓库对应的远程仓库名。默认同时在服务器上重命名，
+// localOnly 为 true 时只把本地仓库指向另一个已有的远程仓库，并清除同步状态。
+func handleRemoteRename(repoDir, newName string, localOnly bool) error {
+	root, err := utils.GetRepoRoot(repoDir)
+	if err != nil {
+		return err
+	}
+	oldName, source := config.LoadRepo(root)
+	if source == "env "+config.EnvRepo {
+		return fmt.Errorf("Failed: repository name is set by %s, unset it first", config.EnvRepo)
+	}
+	if err := config.ValidateRepoName(newName); err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if newName == oldName {
+		return fmt.Errorf("Failed: repository is already named %s", newName)
+	}
+
+	var serverURL string
+	if !localOnly {
+		serverURL, err = loadServerURL(repoDir)
+		if err != nil {
+			return fmt.Errorf("Failed to load config: %w", err)
+		}
+		c, _, err := loadClient(repoDir, serverURL, "Not logged in. Please login first.")
+		if err != nil {
+			return err
+		}
+		if err := c.RenameRepo(rootCtx, oldName, newName); err == client.ErrRenameUnsupported {
+			return fmt.Errorf("Failed: %w (use --local to only change the local repository name)", err)
+		} else if err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+	}
+
+	configPath := config.LocalConfigPath(root)
+	if err := config.SetValue(configPath, "repo", newName); err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	// 指向另一个远程仓库后旧的同步状态不再适用；服务器上重命名后同步状态仍然有效，改为记录新名字
+	if localOnly {
+		if err := utils.ResetSyncState(root); err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+	} else {
+		if base, err := utils.LoadSyncState(root, serverURL, oldName); err == nil && len(base) > 0 {
+			if err := utils.SaveSyncState(root, serverURL, newName, base); err != nil {
+				warn(err)
+			}
+		}
+	}
+
+	if textOutput() {
+		fmt.Printf("✅ Repository renamed: %s -> %s\n", oldName, newName)
+		return nil
+	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"old_name":       oldName,
+		"new_name":       newName,
+		"local_only":     localOnly,
+	})
+	return nil
 }
 
-func handleProfile(repoDir string) {
-	serverURL, err := config.LoadConfig(repoDir)
+// handleConfigList 显示每个生效的配置值及其来源：参数、环境变量、配置文件或默认值
+func handleConfigList(repoDir string) error {
+	var settings []config.Setting
+
+	server, source, err := config.LoadServerSource(repoDir)
+	if err != nil {
+		warn(err)
+	}
+	if globals.server != "" {
+		server, source = globals.server, "flag --server"
+	}
+	settings = append(settings, config.Setting{Key: "server", Value: server, Source: source})
+
+	profile, source, _ := config.ResolveProfileSource(repoDir, globals.profile)
+	settings = append(settings, config.Setting{Key: "profile", Value: profile, Source: source})
+
+	root, err := utils.GetRepoRoot(repoDir)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		os.Exit(1)
+		root, _ = filepath.Abs(repoDir)
 	}
-	token, _, err := config.LoadToken()
+	repo, source := config.LoadRepo(root)
+	settings = append(settings, config.Setting{Key: "repo", Value: repo, Source: source})
+
+	defaults := map[string]int64{
+		"jobs":       client.DefaultJobs,
+		"chunk_size": client.DefaultChunkSize,
+		"chunk_jobs": client.DefaultChunkJobs,
+	}
+	for _, key := range []string{"jobs", "chunk_size", "chunk_jobs"} {
+		value, source := config.LoadIntSource(repoDir, key)
+		if value <= 0 {
+			value = defaults[key]
+		}
+		settings = append(settings, config.Setting{Key: key, Value: fmt.Sprint(value), Source: source})
+	}
+
+	retry := client.DefaultRetryPolicy()
+	attempts, source := config.LoadIntSource(repoDir, "retry_attempts")
+	if attempts <= 0 {
+		attempts = int64(retry.MaxAttempts)
+	}
+	settings = append(settings, config.Setting{Key: "retry_attempts", Value: fmt.Sprint(attempts), Source: source})
+	delayDefaults := map[string]time.Duration{
+		"retry_base_delay": retry.BaseDelay,
+		"retry_max_delay":  retry.MaxDelay,
+	}
+	for _, key := range []string{"retry_base_delay", "retry_max_delay"} {
+		value, source := config.LoadDurationSource(repoDir, key)
+		if value <= 0 {
+			value = delayDefaults[key]
+		}
+		settings = append(settings, config.Setting{Key: key, Value: value.String(), Source: source})
+	}
+	jitter, source, ok := config.LoadRetryJitter(repoDir)
+	if !ok {
+		jitter = retry.Jitter
+	}
+	settings = append(settings, config.Setting{Key: "retry_jitter", Value: fmt.Sprint(jitter), Source: source})
+
+	token, _, source, err := config.LoadTokenSource(server)
 	if err != nil {
-		fmt.Println("❌ not found token，please login first")
-		os.Exit(1)
+		source = "not logged in"
 	}
-	client.Profile(serverURL+ProfilePath, token)
+	if token != "" {
+		token = config.MaskToken(token)
+	}
+	settings = append(settings, config.Setting{Key: "token", Value: token, Source: source})
+
+	if !textOutput() {
+		printJSON(map[string]interface{}{
+			"schema_version": model.OutputSchemaVersion,
+			"settings":       settings,
+		})
+		return nil
+	}
+	for _, s := range settings {
+		fmt.Printf("%-16s %-40s (%s)\n", s.Key, s.Value, s.Source)
+	}
+
+	profiles := config.LoadProfiles(repoDir)
+	for _, name := range utils.SortedKeys(profiles) {
+		fmt.Printf("profile %s - server: %s\n", name, profiles[name].Server)
+	}
+	return nil
 }
 
-func handleListRepos(repoDir string) {
-	serverURL, err := config.LoadConfig(repoDir)
+// configPaths 返回 scope 对应的配置文件，未指定时按 仓库 > 用户主目录 的顺序
+func configPaths(repoDir string, scope configScope) ([]string, error) {
+	var paths []string
+	if scope != scopeGlobal {
+		paths = append(paths, config.LocalConfigPath(repoDir))
+	}
+	if scope != scopeLocal {
+		globalPath, err := config.GlobalConfigPath()
+		if err != nil {
+			return nil, fmt.Errorf("Failed: %w", err)
+		}
+		paths = append(paths, globalPath)
+	}
+	return paths, nil
+}
+
+// handleConfigGet 显示配置项的值以及它来自哪个配置文件
+func handleConfigGet(repoDir, key string, scope configScope) error {
+	paths, err := configPaths(repoDir, scope)
 	if err != nil {
-		fmt.Println("❌ Failed:", err)
-		os.Exit(1)
+		return err
 	}
-	token, _, err := config.LoadToken()
+	for _, path := range paths {
+		value, ok, err := config.GetValue(path, key)
+		if err != nil {
+			return fmt.Errorf("Failed: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		if textOutput() {
+			fmt.Println(value)
+			return nil
+		}
+		printJSON(map[string]interface{}{
+			"schema_version": model.OutputSchemaVersion,
+			"key":            key,
+			"value":          value,
+			"source":         path,
+		})
+		return nil
+	}
+	return fmt.Errorf("%s is not set", key)
+}
+
+// handleConfigSet 修改配置项，未指定 scope 时写入仓库配置
+func handleConfigSet(repoDir, key, value string, scope configScope) error {
+	paths, err := configPaths(repoDir, scope)
 	if err != nil {
-		fmt.Println("❌ not found token，please login first")
-		os.Exit(1)
+		return err
+	}
+	path := paths[0]
+	if _, ok := config.LoadProfiles(repoDir)[value]; key == "profile" && !ok {
+		return fmt.Errorf("Failed: profile %q is not defined in any config file", value)
+	}
+	if err := config.SetValue(path, key, value); err != nil {
+		return fmt.Errorf("Failed: %w", err)
 	}
-	client.RepoList(serverURL+RepoListPath, token)
+	if textOutput() {
+		fmt.Printf("✅ %s = %s saved to: %s\n", key, value, path)
+		return nil
+	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"key":            key,
+		"value":          value,
+		"saved_to":       path,
+	})
+	return nil
 }
 
-func handlePush(repoDir string) {
-	repo, err := utils.GetRepoName(repoDir)
+// handleConfigUnset 删除配置项，未指定 scope 时从仓库配置中删除
+func handleConfigUnset(repoDir, key string, scope configScope) error {
+	paths, err := configPaths(repoDir, scope)
+	if err != nil {
+		return err
+	}
+	path := paths[0]
+	removed, err := config.UnsetValue(path, key)
 	if err != nil {
-		fmt.Println("❌", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if !textOutput() {
+		printJSON(map[string]interface{}{
+			"schema_version": model.OutputSchemaVersion,
+			"key":            key,
+			"removed":        removed,
+			"source":         path,
+		})
+		return nil
+	}
+	if !removed {
+		fmt.Printf("✅ %s is not set in: %s\n", key, path)
+		return nil
 	}
+	fmt.Printf("✅ %s removed from: %s\n", key, path)
+	return nil
+}
 
-	serverURL, err := config.LoadConfig(repoDir)
+// handleConfigUse 设置仓库默认使用的 profile
+func handleConfigUse(repoDir, profile string) error {
+	path, err := config.UseProfile(repoDir, profile)
 	if err != nil {
-		fmt.Println("❌ Failed to load config:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if textOutput() {
+		fmt.Printf("✅ Profile %s set as default in: %s\n", profile, path)
+		return nil
 	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"profile":        profile,
+		"saved_to":       path,
+	})
+	return nil
+}
 
-	token, _, err := config.LoadToken()
+// handleWhoami 显示当前使用的服务器、账号以及 token 来自哪个文件
+func handleWhoami(repoDir string) error {
+	serverURL, err := loadServerURL(repoDir)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	_, _, source, err := config.LoadTokenSource(serverURL)
 	if err != nil {
-		fmt.Println("❌ Not logged in. Please login first.")
-		os.Exit(1)
+		return errors.New("not found token，please login first")
+	}
+	c, _, err := loadClient(repoDir, serverURL, "not found token，please login first")
+	if err != nil {
+		return err
 	}
 
-	remoteFiles, err := client.FetchRemoteFiles(serverURL, token, repo)
+	account := ""
+	profile, err := c.Profile(rootCtx)
 	if err != nil {
-		fmt.Println("❌ Failed to fetch remote files:", err)
-		os.Exit(1)
+		warn("Failed to fetch profile:", err)
+	} else {
+		account = profile.DisplayName()
 	}
 
-	localFiles, err := utils.ScanLocalFiles(repoDir)
+	if !textOutput() {
+		printJSON(map[string]interface{}{
+			"schema_version": model.OutputSchemaVersion,
+			"profile":        config.ActiveProfile(),
+			"server":         serverURL,
+			"account":        account,
+			"token_source":   source,
+		})
+		return nil
+	}
+	if account == "" {
+		account = "unknown"
+	}
+	if profile := config.ActiveProfile(); profile != "" {
+		fmt.Printf("Profile: %s\n", profile)
+	}
+	fmt.Printf("Server:  %s\n", serverURL)
+	fmt.Printf("Account: %s\n", account)
+	fmt.Printf("Token:   %s\n", source)
+	return nil
+}
+
+func handleListRepos(repoDir string) error {
+	serverURL, err := loadServerURL(repoDir)
 	if err != nil {
-		fmt.Println("❌ Failed to scan local files:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed: %w", err)
+	}
+	c, _, err := loadClient(repoDir, serverURL, "not found token，please login first")
+	if err != nil {
+		return err
 	}
 
-	uploadList := client.CompareForUpload(localFiles, remoteFiles)
+	repos, err := c.Repos(rootCtx)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
 
-	for _, file := range uploadList {
-		fmt.Printf("📤 Uploading: %s\n", file.Path)
-		err := client.UploadFile(serverURL, token, repo, file.Path, file.ModTime)
-		if err != nil {
-			fmt.Printf("❌ Upload failed for %s: %v\n", file.Path, err)
-		} else {
-			fmt.Printf("✅ Uploaded: %s\n", file.Path)
+	if textOutput() {
+		fmt.Println("✅ Successfully!")
+		for i, name := range names {
+			fmt.Printf("[%d] %s\n", i+1, name)
 		}
+		return nil
+	}
+	printJSON(map[string]interface{}{
+		"schema_version": model.OutputSchemaVersion,
+		"repos":          names,
+	})
+	return nil
+}
+
+func handlePush(repoDir string, opts syncOptions) error {
+	root, err := utils.GetRepoRoot(repoDir)
+	if err != nil {
+		return err
+	}
+	repo, _ := config.LoadRepo(root)
+
+	serverURL, err := loadServerURL(repoDir)
+	if err != nil {
+		return fmt.Errorf("Failed to load config: %w", err)
+	}
+
+	c, _, err := loadClient(repoDir, serverURL, "Not logged in. Please login first.")
+	if err != nil {
+		return err
+	}
+
+	remoteFiles, err := fetchRemoteFiles(rootCtx, c, repo)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch remote files: %w", err)
+	}
+
+	localFiles, err := utils.ScanLocalFiles(root, opts.rehash)
+	if err != nil {
+		return fmt.Errorf("Failed to scan local files: %w", err)
+	}
+
+	matcher, err := utils.LoadIgnoreMatcher(root)
+	if err != nil {
+		return fmt.Errorf("Failed to load .hfileignore: %w", err)
+	}
+	remoteFiles = utils.FilterIgnored(remoteFiles, matcher)
+
+	base, err := utils.LoadSyncState(root, serverURL, repo)
+	if err != nil {
+		return fmt.Errorf("Failed to load sync state: %w", err)
+	}
+
+	c.Chunks = client.ChunkOptions{
+		Size: config.LoadChunkSize(repoDir),
+		Jobs: config.LoadChunkJobs(repoDir),
+	}
+
+	uploadList := client.CompareForUpload(localFiles, remoteFiles, base)
+	deleteList := client.CompareForRemoteDelete(localFiles, remoteFiles, base)
+	conflicts := client.CompareForConflict(localFiles, remoteFiles, base)
+
+	if opts.strategy == client.ConflictForceLocal {
+		uploadList = append(uploadList, conflicts...)
+		conflicts = nil
+	}
+	for _, file := range conflicts {
+		textf("⚠️ Conflict, not overwriting remote: %s\n", file.Path)
+	}
+
+	var tasks []client.TransferTask
+	for _, file := range uploadList {
+		localPath := filepath.Join(root, filepath.FromSlash(file.Path))
+		tasks = append(tasks, client.TransferTask{
+			Kind: client.TransferUpload,
+			Path: file.Path,
+			Run: func(ctx context.Context) error {
+				return c.Upload(ctx, repo, localPath, file.Path, file.ModTime, file.Hash)
+			},
+		})
+	}
+	for _, file := range deleteList {
+		tasks = append(tasks, client.TransferTask{
+			Kind: client.TransferDeleteRemote,
+			Path: file.Path,
+			Run: func(ctx context.Context) error {
+				return c.Delete(ctx, repo, file.Path)
+			},
+		})
 	}
+
+	summary := newTransferScheduler(resolveJobs(repoDir, opts)).Run(rootCtx, tasks)
+	saveSyncState(root, c, repo, base, succeededPaths(summary))
+
+	if !reportTransfers("push", summary, conflictEntries(conflicts, localFiles, remoteFiles, base)) {
+		return &cli.ExitError{Code: transferExitCode(summary)}
+	}
+	return nil
 }
 
-func handlePull(repoDir string) {
-	repo, err := utils.GetRepoName(repoDir)
+func handlePull(repoDir string, opts syncOptions) error {
+	root, err := utils.GetRepoRoot(repoDir)
 	if err != nil {
-		fmt.Println("❌", err)
-		os.Exit(1)
+		return err
 	}
+	repo, _ := config.LoadRepo(root)
 
-	serverURL, err := config.LoadConfig(repoDir)
+	serverURL, err := loadServerURL(repoDir)
 	if err != nil {
-		fmt.Println("❌ Failed to load config:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to load config: %w", err)
 	}
 
-	token, _, err := config.LoadToken()
+	c, _, err := loadClient(repoDir, serverURL, "Not logged in. Please login first.")
 	if err != nil {
-		fmt.Println("❌ Not logged in. Please login first.")
-		os.Exit(1)
+		return err
 	}
 
-	remoteFiles, err := client.FetchRemoteFiles(serverURL, token, repo)
+	remoteFiles, err := fetchRemoteFiles(rootCtx, c, repo)
 	if err != nil {
-		fmt.Println("❌ Failed to fetch remote files:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to fetch remote files: %w", err)
 	}
 
-	localFiles, err := utils.ScanLocalFiles(".")
+	localFiles, err := utils.ScanLocalFiles(root, opts.rehash)
 	if err != nil {
-		fmt.Println("❌ Failed to scan local files:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to scan local files: %w", err)
 	}
 
-	downloadList := client.CompareForDownload(localFiles, remoteFiles)
+	matcher, err := utils.LoadIgnoreMatcher(root)
+	if err != nil {
+		return fmt.Errorf("Failed to load .hfileignore: %w", err)
+	}
+	remoteFiles = utils.FilterIgnored(remoteFiles, matcher)
+
+	base, err := utils.LoadSyncState(root, serverURL, repo)
+	if err != nil {
+		return fmt.Errorf("Failed to load sync state: %w", err)
+	}
+
+	downloadList := client.CompareForDownload(localFiles, remoteFiles, base)
+	deleteList := client.CompareForLocalDelete(localFiles, remoteFiles, base)
+	conflicts := client.CompareForConflict(localFiles, remoteFiles, base)
+
+	var tasks []client.TransferTask
+	switch opts.strategy {
+	case client.ConflictForceRemote:
+		for _, file := range conflicts {
+			downloadList = append(downloadList, remoteFiles[file.Path])
+		}
+		conflicts = nil
+	case client.ConflictForceLocal:
+		// 保留本地版本，下一次 push --force-local 时覆盖远程
+		conflicts = nil
+	default:
+		host, _ := os.Hostname()
+		now := time.Now()
+		for _, file := range conflicts {
+			remote := remoteFiles[file.Path]
+			if existing, ok := client.FindConflictCopy(root, file.Path, remote.Hash); ok {
+				textf("⚠️ Conflict: %s, remote version already saved as %s\n", file.Path, existing)
+				continue
+			}
+			copyPath := client.ConflictCopyPath(file.Path, host, now)
+			textf("⚠️ Conflict: %s, saving remote version as %s\n", file.Path, copyPath)
+			localPath := filepath.Join(root, filepath.FromSlash(copyPath))
+			tasks = append(tasks, client.TransferTask{
+				Kind: client.TransferDownload,
+				Path: copyPath,
+				Run: func(ctx context.Context) error {
+					return c.Download(ctx, repo, remote.Path, localPath, remote.Hash)
+				},
+			})
+		}
+	}
 
 	for _, file := range downloadList {
-		fmt.Printf("📥 Downloading: %s\n", file.Path)
-		err := client.DownloadFile(serverURL, token, repo, file.Path)
-		if err != nil {
-			fmt.Printf("❌ Download failed for %s: %v\n", file.Path, err)
-		} else {
-			fmt.Printf("✅ Downloaded: %s\n", file.Path)
+		localPath := filepath.Join(root, filepath.FromSlash(file.Path))
+		tasks = append(tasks, client.TransferTask{
+			Kind: client.TransferDownload,
+			Path: file.Path,
+			Run: func(ctx context.Context) error {
+				return c.Download(ctx, repo, file.Path, localPath, file.Hash)
+			},
+		})
+	}
+	for _, file := range deleteList {
+		localPath := filepath.Join(root, filepath.FromSlash(file.Path))
+		tasks = append(tasks, client.TransferTask{
+			Kind: client.TransferDeleteLocal,
+			Path: file.Path,
+			Run: func(ctx context.Context) error {
+				if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			},
+		})
+	}
+
+	summary := newTransferScheduler(resolveJobs(repoDir, opts)).Run(rootCtx, tasks)
+	saveSyncState(root, c, repo, base, succeededPaths(summary))
+
+	if !reportTransfers("pull", summary, conflictEntries(conflicts, localFiles, remoteFiles, base)) {
+		return &cli.ExitError{Code: transferExitCode(summary)}
+	}
+	return nil
+}
+
+// handleClone 从远程仓库创建本地仓库：创建目录、写入配置、下载所有文件并记录同步状态。
+// dir 为空时使用仓库名。
+func handleClone(repo, dir string, opts syncOptions) error {
+	if err := config.ValidateRepoName(repo); err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if dir == "" {
+		dir = repo
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("Failed: destination %s already exists and is not empty", dir)
+	}
+
+	serverURL, err := loadServerURL(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to load config: %w", err)
+	}
+
+	c, _, err := loadClient(dir, serverURL, "Not logged in. Please login first.")
+	if err != nil {
+		return err
+	}
+
+	// 先确认远程仓库可以访问，再创建目录
+	remoteFiles, err := fetchRemoteFiles(rootCtx, c, repo)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch remote files: %w", err)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".hfile"), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory: %w", err)
+	}
+	configPath := config.LocalConfigPath(root)
+	if err := config.SetValue(configPath, "server", serverURL); err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if err := config.SetValue(configPath, "repo", repo); err != nil {
+		return fmt.Errorf("Failed: %w", err)
+	}
+	if profile := config.ActiveProfile(); profile != "" {
+		if err := config.SetValue(configPath, "profile", profile); err != nil {
+			return fmt.Errorf("Failed: %w", err)
 		}
 	}
+	textf("📁 Cloning %s from %s into %s\n", repo, serverURL, dir)
+
+	var tasks []client.TransferTask
+	for _, path := range utils.SortedKeys(remoteFiles) {
+		file := remoteFiles[path]
+		localPath := filepath.Join(root, filepath.FromSlash(file.Path))
+		tasks = append(tasks, client.TransferTask{
+			Kind: client.TransferDownload,
+			Path: file.Path,
+			Run: func(ctx context.Context) error {
+				return c.Download(ctx, repo, file.Path, localPath, file.Hash)
+			},
+		})
+	}
+
+	summary := newTransferScheduler(resolveJobs(root, opts)).Run(rootCtx, tasks)
+	saveSyncState(root, c, repo, map[string]model.SyncEntry{}, succeededPaths(summary))
+
+	if !reportTransfers("clone", summary, nil) {
+		textf("Run 'hfile pull' in %s to retry the failed downloads.\n", dir)
+		return &cli.ExitError{Code: transferExitCode(summary)}
+	}
+	return nil
+}
+
+// fetchRemoteFiles 返回远程仓库中按路径索引的文件
+func fetchRemoteFiles(ctx context.Context, c *client.Client, repo string) (map[string]model.FileMeta, error) {
+	files, err := c.Files(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return client.FileMap(files), nil
+}
+
+// saveSyncState 重新读取两侧文件列表并记录本次同步后的状态。
+// 传输被中断时也要记录已完成的文件，因此不使用已取消的 rootCtx。
+func saveSyncState(root string, c *client.Client, repo string, base map[string]model.SyncEntry, done map[string]bool) {
+	remoteFiles, err := fetchRemoteFiles(context.WithoutCancel(rootCtx), c, repo)
+	if err != nil {
+		warn("Failed to refresh remote files, sync state not updated:", err)
+		return
+	}
+
+	localFiles, err := utils.ScanLocalFiles(root, false)
+	if err != nil {
+		warn("Failed to rescan local files, sync state not updated:", err)
+		return
+	}
+
+	matcher, err := utils.LoadIgnoreMatcher(root)
+	if err != nil {
+		warn("Failed to load .hfileignore, sync state not updated:", err)
+		return
+	}
+	remoteFiles = utils.FilterIgnored(remoteFiles, matcher)
+
+	state := client.BuildSyncState(base, localFiles, remoteFiles, done)
+	if err := utils.SaveSyncState(root, c.BaseURL, repo, state); err != nil {
+		warn(err)
+	}
 }
 
-func handleStatus(repoDir string) {
-	repo, err := utils.GetRepoName(repoDir)
+func handleStatus(repoDir string, opts syncOptions) error {
+	root, err := utils.GetRepoRoot(repoDir)
 	if err != nil {
-		fmt.Println("❌", err)
-		os.Exit(1)
+		return err
 	}
+	repo, _ := config.LoadRepo(root)
 
-	serverURL, err := config.LoadConfig(repoDir)
+	serverURL, err := loadServerURL(repoDir)
 	if err != nil {
-		fmt.Println("❌ Failed to load config:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to load config: %w", err)
 	}
 
-	token, _, err := config.LoadToken()
+	c, _, err := loadClient(repoDir, serverURL, "Not logged in. Please login first.")
 	if err != nil {
-		fmt.Println("❌ Not logged in. Please login first.")
-		os.Exit(1)
+		return err
 	}
 
-	remoteFiles, err := client.FetchRemoteFiles(serverURL, token, repo)
+	remoteFiles, err := fetchRemoteFiles(rootCtx, c, repo)
 	if err != nil {
-		fmt.Println("❌ Failed to fetch remote files:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to fetch remote files: %w", err)
 	}
 
-	localFiles, err := utils.ScanLocalFiles(repoDir)
+	localFiles, err := utils.ScanLocalFiles(root, opts.rehash)
 	if err != nil {
-		fmt.Println("❌ Failed to scan local files:", err)
-		os.Exit(1)
+		return fmt.Errorf("Failed to scan local files: %w", err)
 	}
 
-	toUpload := client.CompareForUpload(localFiles, remoteFiles)
-	toDownload := client.CompareForDownload(localFiles, remoteFiles)
+	matcher, err := utils.LoadIgnoreMatcher(root)
+	if err != nil {
+		return fmt.Errorf("Failed to load .hfileignore: %w", err)
+	}
+	remoteFiles = utils.FilterIgnored(remoteFiles, matcher)
+
+	base, err := utils.LoadSyncState(root, serverURL, repo)
+	if err != nil {
+		return fmt.Errorf("Failed to load sync state: %w", err)
+	}
 
-	if len(toUpload) > 0 {
+	if !textOutput() {
+		entries := client.BuildStatus(localFiles, remoteFiles, base)
+		if globals.output == outputNDJSON {
+			for _, entry := range entries {
+				entry.SchemaVersion = model.OutputSchemaVersion
+				printJSON(entry)
+			}
+			return nil
+		}
+		printJSON(model.StatusReport{
+			SchemaVersion: model.OutputSchemaVersion,
+			Repo:          repo,
+			Entries:       entries,
+		})
+		return nil
+	}
+
+	toUpload := client.CompareForUpload(localFiles, remoteFiles, base)
+	toDownload := client.CompareForDownload(localFiles, remoteFiles, base)
+	toDeleteRemote := client.CompareForRemoteDelete(localFiles, remoteFiles, base)
+	toDeleteLocal := client.CompareForLocalDelete(localFiles, remoteFiles, base)
+	conflicts := client.CompareForConflict(localFiles, remoteFiles, base)
+
+	if len(toUpload) > 0 || len(toDeleteRemote) > 0 {
 		fmt.Println("🟢 Files to upload:")
 		for _, f := range toUpload {
 			fmt.Println("  +", f.Path)
 		}
+		for _, f := range toDeleteRemote {
+			fmt.Println("  x", f.Path, "(deleted locally)")
+		}
 	} else {
 		fmt.Println("🟢 No files need to be uploaded.")
 	}
 
-	if len(toDownload) > 0 {
+	if len(toDownload) > 0 || len(toDeleteLocal) > 0 {
 		fmt.Println("🔵 Files to download:")
 		for _, f := range toDownload {
 			fmt.Println("  -", f.Path)
 		}
+		for _, f := range toDeleteLocal {
+			fmt.Println("  x", f.Path, "(deleted remotely)")
+		}
 	} else {
 		fmt.Println("🔵 No files need to be download.")
 	}
 
+	if len(conflicts) > 0 {
+		fmt.Println("🔴 Conflicts (changed locally and remotely since last sync):")
+		for _, f := range conflicts {
+			fmt.Println("  !", f.Path)
+		}
+	}
+	return nil
+}
+
+func handleCheckIgnore(path string) error {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	root, err := utils.GetRepoRoot(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	relPath, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+
+	matcher, err := utils.LoadIgnoreMatcher(root)
+	if err != nil {
+		return fmt.Errorf("Failed to load .hfileignore: %w", err)
+	}
+
+	isDir := false
+	if info, err := os.Stat(target); err == nil {
+		isDir = info.IsDir()
+	}
+
+	rule, ignored := matcher.Match(relPath, isDir)
+	if rule == nil {
+		fmt.Printf("%s: not ignored\n", filepath.ToSlash(relPath))
+		return &cli.ExitError{Code: cli.ExitFailure}
+	}
+	if !ignored {
+		fmt.Printf("%s\t%s (not ignored)\n", rule.Describe(), filepath.ToSlash(relPath))
+		return &cli.ExitError{Code: cli.ExitFailure}
+	}
+	fmt.Printf("%s\t%s\n", rule.Describe(), filepath.ToSlash(relPath))
+	return nil
+}
+
+// handleServe 启动服务器，直到收到 SIGINT/SIGTERM
+func handleServe(opts server.Options) error {
+	srv, err := server.New(opts)
+	if err != nil {
+		return fmt.Errorf("Failed to start server: %w", err)
+	}
+	opts = srv.Options()
+	fmt.Printf("✅ hfile server listening on %s, data in %s\n", opts.Addr, opts.DataDir)
+	srv.Spin()
+	return nil
 }
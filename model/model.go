@@ -12,6 +12,10 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type APIResponse struct {
 	Code  int         `json:"code"`
 	Msg   *string     `json:"msg"`
@@ -20,10 +24,20 @@ type APIResponse struct {
 	Data  interface{} `json:"data"`
 }
 
+// FileMeta 描述仓库中的一个文件，Hash 为文件内容的 SHA-256（十六进制）
 type FileMeta struct {
 	Path    string `json:"path"`
 	Hash    string `json:"hash"`
 	ModTime int64  `json:"mod_time"`
+	Size    int64  `json:"size,omitempty"`
+}
+
+// SyncEntry 记录上一次同步完成时文件在本地和远程两侧的状态，作为三方比较的基准
+type SyncEntry struct {
+	Path       string `json:"path"`
+	Hash       string `json:"hash"`
+	RemoteHash string `json:"remote_hash"`
+	ModTime    int64  `json:"mod_time"`
 }
 
 // 在 model 包中添加以下结构体
@@ -35,3 +49,14 @@ type ChunkUploadResponse struct {
 	ETag       string `json:"etag,omitempty"`
 	IsComplete bool   `json:"is_complete,omitempty"`
 }
+
+// CompletedPart 是已被服务器确认的分片，完成上传时按序号提交给服务器校验拼接顺序
+type CompletedPart struct {
+	PartIndex int    `json:"part_index"`
+	ETag      string `json:"etag,omitempty"`
+}
+
+type CompleteUploadRequest struct {
+	UploadID string          `json:"upload_id"`
+	Parts    []CompletedPart `json:"parts"`
+}
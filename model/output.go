@@ -0,0 +1,83 @@
+package model
+
+// OutputSchemaVersion 是 --output json/ndjson 输出的结构版本。
+// 新增字段不会改变版本号；删除、重命名字段或改变字段含义时递增。
+const OutputSchemaVersion = 1
+
+// StatusEntry 是 status 输出中的一个文件。
+//
+//	schema_version  只在 status --output ndjson 的每一行中出现
+//	path            仓库内的相对路径，使用 / 分隔
+//	action          upload | download | delete-remote | delete-local | conflict
+//	local_hash      本地文件内容的 SHA-256，本地不存在时省略
+//	remote_hash     远程文件内容的 SHA-256，远程不存在时省略
+//	local_size      本地文件字节数，本地不存在时省略，空文件为 0
+//	remote_size     远程文件字节数，远程不存在时省略，空文件为 0
+//	reason          产生该操作的原因，例如 "modified locally"、"deleted remotely"
+type StatusEntry struct {
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	Path          string `json:"path"`
+	Action        string `json:"action"`
+	LocalHash     string `json:"local_hash,omitempty"`
+	RemoteHash    string `json:"remote_hash,omitempty"`
+	LocalSize     *int64 `json:"local_size,omitempty"`
+	RemoteSize    *int64 `json:"remote_size,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// StatusReport 是 status --output json 的完整输出，ndjson 模式下每行输出一个带 schema_version 的 StatusEntry
+type StatusReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	Repo          string        `json:"repo"`
+	Entries       []StatusEntry `json:"entries"`
+}
+
+// TransferEvent 是 push/pull --output ndjson 中的一行。
+//
+//	event     start | retry | done
+//	kind      upload | download | delete-remote | delete-local
+//	status    done 事件中为 ok、failed 或 interrupted（被 Ctrl-C 中断）
+//	error     失败原因，仅在 status 为 failed 或 interrupted 时出现；retry 事件中为上一次尝试的错误
+//	attempt   retry 事件中即将进行的尝试序号，第一次重试为 2
+//	delay_ms  retry 事件中重试前等待的毫秒数
+type TransferEvent struct {
+	SchemaVersion int    `json:"schema_version"`
+	Event         string `json:"event"`
+	Kind          string `json:"kind"`
+	Path          string `json:"path"`
+	Status        string `json:"status,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Attempt       int    `json:"attempt,omitempty"`
+	DelayMs       int64  `json:"delay_ms,omitempty"`
+}
+
+// TransferResult 是一次传输的最终结果，status 为 ok、failed、interrupted 或 skipped（中断后未开始）
+// retries 是因临时错误重试的次数，没有重试时省略。
+type TransferResult struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Retries int    `json:"retries,omitempty"`
+}
+
+// TransferReport 汇总 push/pull 的结果。json 模式下是唯一的输出，
+// ndjson 模式下作为最后一行输出，event 为 summary。
+// interrupted 和 skipped 是被 Ctrl-C 中断和因此未开始的传输数。
+type TransferReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Event         string           `json:"event,omitempty"`
+	Command       string           `json:"command"`
+	Succeeded     int              `json:"succeeded"`
+	Failed        int              `json:"failed"`
+	Interrupted   int              `json:"interrupted"`
+	Skipped       int              `json:"skipped"`
+	Results       []TransferResult `json:"results"`
+	Conflicts     []StatusEntry    `json:"conflicts"`
+}
+
+// ErrorReport 是命令失败时在 json/ndjson 模式下的输出
+type ErrorReport struct {
+	SchemaVersion int    `json:"schema_version"`
+	Error         string `json:"error"`
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/litongjava/hfile/cli"
+	"github.com/litongjava/hfile/model"
+)
+
+// 输出格式，由 --output 选择
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// textOutput 是否输出给人看的文本，json/ndjson 模式下只输出结构化结果
+func textOutput() bool {
+	return globals.output == outputText
+}
+
+// printJSON 按当前格式输出一个 JSON 值，ndjson 模式下每个值占一行
+func printJSON(v interface{}) {
+	var data []byte
+	var err error
+	if globals.output == outputNDJSON {
+		data, err = json.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to encode output:", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// reportError 在 json/ndjson 模式下把命令返回的错误输出为 ErrorReport，
+// 并换成不带信息的 cli.ExitError，由 App 只设置退出码。文本模式下错误由 App 输出。
+func reportError(err error) error {
+	if err == nil || textOutput() {
+		return err
+	}
+	var usageErr *cli.UsageError
+	if errors.As(err, &usageErr) {
+		return err
+	}
+	code, msg := cli.ExitFailure, err.Error()
+	var exitErr *cli.ExitError
+	if errors.As(err, &exitErr) {
+		code, msg = exitErr.Code, exitErr.Msg
+	}
+	if msg != "" {
+		printJSON(model.ErrorReport{SchemaVersion: model.OutputSchemaVersion, Error: msg})
+	}
+	return &cli.ExitError{Code: code}
+}
+
+// textf 只在文本模式下输出
+func textf(format string, a ...interface{}) {
+	if textOutput() {
+		fmt.Printf(format, a...)
+	}
+}
+
+// warn 输出不影响结果的警告，json/ndjson 模式下写到标准错误以免破坏结构化输出
+func warn(a ...interface{}) {
+	msg := fmt.Sprintln(a...)
+	if textOutput() {
+		fmt.Print("⚠️ ", msg)
+	} else {
+		fmt.Fprint(os.Stderr, "⚠️ ", msg)
+	}
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/litongjava/hfile/model"
+)
+
+const (
+	pbkdf2Iterations = 600000
+	minPasswordLen   = 6
+	maxUsernameLen   = 64
+	// userKey 是认证中间件保存用户名的上下文键
+	userKey = "hfile.user"
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid username or password")
+	errUserExists         = errors.New("already registered")
+)
+
+func (s *Server) handleRegister(ctx context.Context, c *app.RequestContext) {
+	var req model.RegisterRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+		respondError(c, 400, "invalid request body")
+		return
+	}
+
+	var errs []fieldError
+	if msgs := validateUsername(req.Username); len(msgs) > 0 {
+		errs = append(errs, fieldError{Field: "username", Messages: msgs})
+	}
+	if len(req.Password) < minPasswordLen {
+		errs = append(errs, fieldError{Field: "password", Messages: []string{"must be at least 6 characters"}})
+	}
+	if len(errs) > 0 {
+		respondFieldErrors(c, errs)
+		return
+	}
+
+	salt := randomHex(16)
+	hash, err := hashPassword(req.Password, salt)
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	u := &user{ID: randomHex(8), Username: req.Username, PasswordHash: hash, Salt: salt, CreatedAt: time.Now().UTC()}
+
+	err = s.store.update(func(m *metadata) error {
+		if _, ok := m.Users[req.Username]; ok {
+			return errUserExists
+		}
+		m.Users[req.Username] = u
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errUserExists) {
+			respondFieldErrors(c, []fieldError{{Field: "username", Messages: []string{err.Error()}}})
+			return
+		}
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, profileData(u))
+}
+
+func (s *Server) handleLogin(ctx context.Context, c *app.RequestContext) {
+	var req model.LoginRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+		respondError(c, 400, "invalid request body")
+		return
+	}
+
+	var u *user
+	s.store.view(func(m *metadata) {
+		u = m.Users[req.Username]
+	})
+	if u == nil || !checkPassword(u, req.Password) {
+		respondError(c, 401, errInvalidCredentials.Error())
+		return
+	}
+
+	tokens, err := s.newSession(u.Username, "")
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, tokens)
+}
+
+// handleRefresh 用 refresh token 换取新的 access token，旧的 access token 同时失效
+func (s *Server) handleRefresh(ctx context.Context, c *app.RequestContext) {
+	var req model.RefreshRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil || req.RefreshToken == "" {
+		respondError(c, 400, "refresh_token is required")
+		return
+	}
+
+	var username string
+	s.store.view(func(m *metadata) {
+		token, ok := m.Refresh[req.RefreshToken]
+		if !ok {
+			return
+		}
+		if sess, ok := m.Sessions[token]; ok && time.Now().Before(sess.RefreshExpires) {
+			username = sess.Username
+		}
+	})
+	if username == "" {
+		respondError(c, 401, "invalid or expired refresh token")
+		return
+	}
+
+	tokens, err := s.newSession(username, req.RefreshToken)
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, tokens)
+}
+
+// handleLogout 注销 Authorization 中的 access token 和请求体中的 refresh token，
+// 令牌已失效时同样返回成功
+func (s *Server) handleLogout(ctx context.Context, c *app.RequestContext) {
+	var req model.RefreshRequest
+	_ = json.Unmarshal(c.Request.Body(), &req)
+	token := bearerToken(c)
+
+	err := s.store.update(func(m *metadata) error {
+		if req.RefreshToken != "" {
+			if access, ok := m.Refresh[req.RefreshToken]; ok {
+				delete(m.Sessions, access)
+				delete(m.Refresh, req.RefreshToken)
+			}
+		}
+		if sess, ok := m.Sessions[token]; ok {
+			delete(m.Refresh, sess.RefreshToken)
+			delete(m.Sessions, token)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, nil)
+}
+
+func (s *Server) handleProfile(ctx context.Context, c *app.RequestContext) {
+	var u *user
+	s.store.view(func(m *metadata) {
+		u = m.Users[currentUser(c)]
+	})
+	if u == nil {
+		respondError(c, 401, "user not found")
+		return
+	}
+	respond(c, profileData(u))
+}
+
+// requireAuth 校验 Bearer token，失败时返回 401，客户端据此刷新令牌
+func (s *Server) requireAuth(ctx context.Context, c *app.RequestContext) {
+	token := bearerToken(c)
+	if token == "" {
+		respondError(c, 401, "missing token")
+		return
+	}
+
+	var sess session
+	var ok bool
+	s.store.view(func(m *metadata) {
+		sess, ok = m.Sessions[token]
+	})
+	if !ok {
+		respondError(c, 401, "invalid token")
+		return
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		respondError(c, 401, "token expired")
+		return
+	}
+	c.Set(userKey, sess.Username)
+	c.Next(ctx)
+}
+
+// newSession 创建新的 access token。refresh 为空时同时创建新的 refresh token（登录），
+// 否则沿用 refresh token 及其有效期并撤销它之前对应的 access token（刷新）。
+// refresh token 不轮换，多个进程共用同一份凭证时先后刷新都能成功。
+func (s *Server) newSession(username, refresh string) (map[string]string, error) {
+	now := time.Now()
+	token := randomHex(32)
+
+	err := s.store.update(func(m *metadata) error {
+		sess := session{Username: username, RefreshToken: refresh, ExpiresAt: now.Add(s.opts.TokenTTL)}
+		if refresh == "" {
+			sess.RefreshToken = randomHex(32)
+			sess.RefreshExpires = now.Add(s.opts.RefreshTTL)
+		} else {
+			old := m.Refresh[refresh]
+			sess.RefreshExpires = m.Sessions[old].RefreshExpires
+			delete(m.Sessions, old)
+		}
+		// 清理 refresh token 也已过期的会话
+		for t, old := range m.Sessions {
+			if now.After(old.RefreshExpires) {
+				delete(m.Refresh, old.RefreshToken)
+				delete(m.Sessions, t)
+			}
+		}
+		m.Sessions[token] = sess
+		m.Refresh[sess.RefreshToken] = token
+		refresh = sess.RefreshToken
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"token": token, "refresh_token": refresh}, nil
+}
+
+// currentUser 返回认证中间件识别出的用户名
+func currentUser(c *app.RequestContext) string {
+	return c.GetString(userKey)
+}
+
+func bearerToken(c *app.RequestContext) string {
+	auth := string(c.GetHeader("Authorization"))
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func profileData(u *user) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         u.ID,
+		"username":   u.Username,
+		"created_at": u.CreatedAt.Unix(),
+	}
+}
+
+func validateUsername(name string) []string {
+	var msgs []string
+	if name == "" {
+		return []string{"is required"}
+	}
+	if len(name) > maxUsernameLen {
+		msgs = append(msgs, "must be at most 64 characters")
+	}
+	// 用户名用作 blobs 下的目录名
+	if strings.ContainsAny(name, `/\:*?"<>|`) || name == "." || name == ".." || strings.ContainsRune(name, 0) {
+		msgs = append(msgs, "contains invalid characters")
+	}
+	return msgs
+}
+
+func hashPassword(password, salt string) (string, error) {
+	key, err := pbkdf2.Key(sha256.New, password, []byte(salt), pbkdf2Iterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func checkPassword(u *user, password string) bool {
+	hash, err := hashPassword(password, u.Salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(u.PasswordHash)) == 1
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
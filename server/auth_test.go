@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/model"
+)
+
+func TestRequireAuth(t *testing.T) {
+	ts := newTestServer(t, Options{})
+
+	expired, err := ts.newSession(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.store.update(func(m *metadata) error {
+		sess := m.Sessions[expired["token"]]
+		sess.ExpiresAt = time.Now().Add(-time.Minute)
+		m.Sessions[expired["token"]] = sess
+		return nil
+	})
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+		msg    string
+	}{
+		{name: "valid token", auth: "Bearer " + ts.token, status: 200},
+		{name: "lowercase scheme", auth: "bearer " + ts.token, status: 200},
+		{name: "missing header", auth: "", status: 401, msg: "missing token"},
+		{name: "other scheme", auth: "Basic " + ts.token, status: 401, msg: "missing token"},
+		{name: "unknown token", auth: "Bearer 0123", status: 401, msg: "invalid token"},
+		{name: "expired token", auth: "Bearer " + expired["token"], status: 401, msg: "token expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ts.request(t, "GET", "/repo/list", nil, nil, http.Header{"Authorization": {tt.auth}})
+			if r.status != tt.status || !strings.Contains(r.msg(), tt.msg) {
+				t.Errorf("GET /repo/list = %d %q, want %d %q", r.status, r.msg(), tt.status, tt.msg)
+			}
+		})
+	}
+}
+
+func TestLoginRefreshLogout(t *testing.T) {
+	ts := newTestServer(t, Options{TokenTTL: time.Hour})
+	noAuth := http.Header{"Authorization": {""}}
+
+	r := ts.postJSON(t, "/api/v1/register", nil, model.RegisterRequest{Username: "carol", Password: "short"})
+	if r.status != 400 {
+		t.Fatalf("register with a short password = %d, want 400", r.status)
+	}
+	if r = ts.postJSON(t, "/api/v1/register", nil, model.RegisterRequest{Username: "carol", Password: "secret123"}); r.status != 200 {
+		t.Fatalf("register: %d %s", r.status, r.body)
+	}
+	if r = ts.postJSON(t, "/api/v1/login", nil, model.LoginRequest{Username: "carol", Password: "wrong-password"}); r.status != 401 {
+		t.Fatalf("login with a wrong password = %d, want 401", r.status)
+	}
+	r = ts.postJSON(t, "/api/v1/login", nil, model.LoginRequest{Username: "carol", Password: "secret123"})
+	var login map[string]string
+	r.decode(&login)
+	if r.status != 200 || login["token"] == "" || login["refresh_token"] == "" {
+		t.Fatalf("login: %d %s", r.status, r.body)
+	}
+
+	carol := *ts
+	carol.token = login["token"]
+	if r = carol.request(t, "GET", "/api/v1/user/profile", nil, nil, nil); r.status != 200 {
+		t.Fatalf("profile: %d %s", r.status, r.body)
+	}
+
+	// 刷新后旧的 access token 失效，refresh token 保持不变
+	r = ts.postJSON(t, "/api/v1/refresh", nil, model.RefreshRequest{RefreshToken: login["refresh_token"]})
+	var refreshed map[string]string
+	r.decode(&refreshed)
+	if r.status != 200 || refreshed["token"] == "" || refreshed["token"] == login["token"] || refreshed["refresh_token"] != login["refresh_token"] {
+		t.Fatalf("refresh: %d %s", r.status, r.body)
+	}
+	if r = carol.request(t, "GET", "/api/v1/user/profile", nil, nil, nil); r.status != 401 {
+		t.Errorf("profile with the replaced token = %d, want 401", r.status)
+	}
+	carol.token = refreshed["token"]
+	if r = carol.request(t, "GET", "/api/v1/user/profile", nil, nil, nil); r.status != 200 {
+		t.Errorf("profile with the refreshed token = %d, want 200", r.status)
+	}
+
+	// refresh token 过期后不能再刷新
+	ts.store.update(func(m *metadata) error {
+		sess := m.Sessions[refreshed["token"]]
+		sess.RefreshExpires = time.Now().Add(-time.Minute)
+		m.Sessions[refreshed["token"]] = sess
+		return nil
+	})
+	if r = ts.postJSON(t, "/api/v1/refresh", nil, model.RefreshRequest{RefreshToken: login["refresh_token"]}); r.status != 401 {
+		t.Errorf("refresh with an expired refresh token = %d, want 401", r.status)
+	}
+
+	// 注销后令牌失效，重复注销同样成功
+	for i := 0; i < 2; i++ {
+		if r = carol.postJSON(t, "/api/v1/logout", nil, model.RefreshRequest{RefreshToken: login["refresh_token"]}); r.status != 200 {
+			t.Errorf("logout #%d = %d, want 200", i+1, r.status)
+		}
+	}
+	if r = carol.request(t, "GET", "/api/v1/user/profile", nil, nil, nil); r.status != 401 {
+		t.Errorf("profile after logout = %d, want 401", r.status)
+	}
+	if r = ts.request(t, "GET", "/repo/list", nil, nil, noAuth); r.status != 401 {
+		t.Errorf("repo list without a token = %d, want 401", r.status)
+	}
+}
@@ -0,0 +1,415 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/litongjava/hfile/model"
+)
+
+// maxTotalParts 限制单个上传的分片数，避免 init 请求中的异常值
+const maxTotalParts = 100000
+
+// sweepInterval 是两次清理过期分片上传之间的最短间隔
+const sweepInterval = 10 * time.Minute
+
+var errUploadNotFound = errors.New("upload not found")
+
+// chunkUpload 是一个进行中的分片上传，保存在 uploads/<upload_id>/info.json，
+// 分片内容保存在同目录下的 part-<index>
+type chunkUpload struct {
+	UploadID   string    `json:"upload_id"`
+	Username   string    `json:"username"`
+	Repo       string    `json:"repo"`
+	FileName   string    `json:"file_name"`
+	FileSize   int64     `json:"file_size"`
+	TotalParts int       `json:"total_parts"`
+	ModTime    int64     `json:"original_mod_time"`
+	Hash       string    `json:"hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// UpdatedAt 是最后一次收到分片的时间，清理过期上传时以它为准，进行中的长时间上传不会被清理
+	UpdatedAt time.Time      `json:"updated_at"`
+	Parts     map[int]string `json:"parts"`
+}
+
+// initRequest 是 /file/upload/init 的请求体
+type initRequest struct {
+	Repo       string `json:"repo"`
+	FileName   string `json:"file_name"`
+	FileSize   int64  `json:"file_size"`
+	TotalParts int    `json:"total_parts"`
+	ModTime    int64  `json:"original_mod_time"`
+	Hash       string `json:"hash"`
+}
+
+// uploadManager 管理分片上传的状态文件。每个 upload_id 有自己的锁，
+// 同一个上传同一时刻只有一个请求修改 info.json，不同上传的请求互不阻塞。
+type uploadManager struct {
+	dir string
+	ttl time.Duration
+
+	mu        sync.Mutex
+	locks     map[string]*uploadLock
+	lastSweep time.Time
+}
+
+// uploadLock 是一个 upload_id 的锁，refs 为持有或等待该锁的请求数，为 0 时从 locks 中删除
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newUploadManager(dir string, ttl time.Duration) *uploadManager {
+	return &uploadManager{dir: dir, ttl: ttl, locks: map[string]*uploadLock{}}
+}
+
+// lock 锁定一个上传，返回解锁函数
+func (u *uploadManager) lock(id string) func() {
+	u.mu.Lock()
+	l := u.locks[id]
+	if l == nil {
+		l = &uploadLock{}
+		u.locks[id] = l
+	}
+	l.refs++
+	u.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		u.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(u.locks, id)
+		}
+		u.mu.Unlock()
+	}
+}
+
+// maybeSweep 距上次清理超过 sweepInterval 时在后台清理过期的上传
+func (u *uploadManager) maybeSweep(now time.Time) {
+	u.mu.Lock()
+	due := now.Sub(u.lastSweep) >= sweepInterval
+	if due {
+		u.lastSweep = now
+	}
+	u.mu.Unlock()
+	if due {
+		go u.sweep(now)
+	}
+}
+
+// sweep 删除最后活动时间早于 now - ttl 的上传目录
+func (u *uploadManager) sweep(now time.Time) {
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return
+	}
+	deadline := now.Add(-u.ttl)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id := entry.Name()
+		unlock := u.lock(id)
+		if active := u.lastActivity(entry); !active.IsZero() && active.Before(deadline) {
+			os.RemoveAll(u.uploadDir(id))
+		}
+		unlock()
+	}
+}
+
+// lastActivity 返回上传最后一次收到分片的时间。旧版本的 info.json 没有 updated_at，使用创建时间；
+// 没有可读 info.json 的目录使用目录的修改时间
+func (u *uploadManager) lastActivity(entry os.DirEntry) time.Time {
+	var upload chunkUpload
+	if data, err := os.ReadFile(filepath.Join(u.uploadDir(entry.Name()), "info.json")); err == nil && json.Unmarshal(data, &upload) == nil {
+		if !upload.UpdatedAt.IsZero() {
+			return upload.UpdatedAt
+		}
+		return upload.CreatedAt
+	}
+	if info, err := entry.Info(); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+func (u *uploadManager) uploadDir(id string) string {
+	return filepath.Join(u.dir, id)
+}
+
+func (u *uploadManager) partPath(id string, index int) string {
+	return filepath.Join(u.uploadDir(id), "part-"+strconv.Itoa(index))
+}
+
+// load 读取上传状态，upload_id 不存在或不属于 username 时返回 errUploadNotFound
+func (u *uploadManager) load(id, username string) (*chunkUpload, error) {
+	// upload_id 用作目录名，只接受 create 生成的十六进制字符串
+	if id == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		return nil, errUploadNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(u.uploadDir(id), "info.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errUploadNotFound
+		}
+		return nil, err
+	}
+	var upload chunkUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to parse upload %s: %w", id, err)
+	}
+	if upload.Username != username {
+		return nil, errUploadNotFound
+	}
+	if upload.Parts == nil {
+		upload.Parts = map[int]string{}
+	}
+	return &upload, nil
+}
+
+func (u *uploadManager) save(upload *chunkUpload) error {
+	data, err := json.MarshalIndent(upload, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(u.uploadDir(upload.UploadID), "info.json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *Server) handleUploadInit(ctx context.Context, c *app.RequestContext) {
+	var req initRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+		respondError(c, 400, "invalid request body")
+		return
+	}
+	repo := req.Repo
+	if repo == "" {
+		repo = c.Query("repo")
+	}
+	if !checkRepo(c, repo) {
+		return
+	}
+	filePath, err := cleanRemotePath(req.FileName)
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+	if req.FileSize < 0 || req.TotalParts <= 0 || req.TotalParts > maxTotalParts {
+		respondError(c, 400, "invalid file_size or total_parts")
+		return
+	}
+	if req.ModTime <= 0 {
+		req.ModTime = time.Now().Unix()
+	}
+
+	now := time.Now().UTC()
+	upload := &chunkUpload{
+		UploadID:   randomHex(16),
+		Username:   currentUser(c),
+		Repo:       repo,
+		FileName:   filePath,
+		FileSize:   req.FileSize,
+		TotalParts: req.TotalParts,
+		ModTime:    req.ModTime,
+		Hash:       strings.ToLower(req.Hash),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Parts:      map[int]string{},
+	}
+	if err := os.MkdirAll(s.uploads.uploadDir(upload.UploadID), 0755); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	if err := s.uploads.save(upload); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	s.uploads.maybeSweep(now)
+	respond(c, map[string]interface{}{"upload_id": upload.UploadID})
+}
+
+// handleUploadChunk 接收一个分片，重复上传同一序号时覆盖之前的内容，etag 为分片的 SHA-256
+func (s *Server) handleUploadChunk(ctx context.Context, c *app.RequestContext) {
+	username := currentUser(c)
+	part, err := s.readMultipart(c)
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+	defer part.cleanup()
+
+	id := part.Fields["upload_id"]
+	index, err := strconv.Atoi(part.Fields["part_index"])
+	if err != nil {
+		respondError(c, 400, "invalid part_index")
+		return
+	}
+
+	defer s.uploads.lock(id)()
+
+	upload, err := s.uploads.load(id, username)
+	if err != nil {
+		respondUploadError(c, id, err)
+		return
+	}
+	if index < 0 || index >= upload.TotalParts {
+		respondError(c, 400, fmt.Sprintf("part_index %d out of range [0, %d)", index, upload.TotalParts))
+		return
+	}
+	if err := os.Rename(part.TmpPath, s.uploads.partPath(id, index)); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	upload.Parts[index] = part.Hash
+	upload.UpdatedAt = time.Now().UTC()
+	if err := s.uploads.save(upload); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, model.ChunkUploadResponse{PartIndex: index, UploadID: id, ETag: part.Hash})
+}
+
+// handleUploadStatus 返回已接收的分片，客户端据此续传
+func (s *Server) handleUploadStatus(ctx context.Context, c *app.RequestContext) {
+	id := c.Query("upload_id")
+	unlock := s.uploads.lock(id)
+	upload, err := s.uploads.load(id, currentUser(c))
+	unlock()
+	if err != nil {
+		respondUploadError(c, id, err)
+		return
+	}
+	respond(c, map[string]interface{}{
+		"upload_id":   upload.UploadID,
+		"total_parts": upload.TotalParts,
+		"parts":       sortedParts(upload.Parts),
+	})
+}
+
+// handleUploadComplete 按序号拼接分片，校验每个分片的 etag、总大小和 SHA-256 后提交文件
+func (s *Server) handleUploadComplete(ctx context.Context, c *app.RequestContext) {
+	var req model.CompleteUploadRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+		respondError(c, 400, "invalid request body")
+		return
+	}
+
+	// 只锁定这一个上传，拼接和计算哈希期间其它上传的请求不受影响
+	defer s.uploads.lock(req.UploadID)()
+
+	upload, err := s.uploads.load(req.UploadID, currentUser(c))
+	if err != nil {
+		respondUploadError(c, req.UploadID, err)
+		return
+	}
+	if len(req.Parts) != upload.TotalParts {
+		respondError(c, 400, fmt.Sprintf("expected %d parts, got %d", upload.TotalParts, len(req.Parts)))
+		return
+	}
+	sort.Slice(req.Parts, func(i, j int) bool { return req.Parts[i].PartIndex < req.Parts[j].PartIndex })
+	for i, part := range req.Parts {
+		etag, ok := upload.Parts[part.PartIndex]
+		if part.PartIndex != i || !ok {
+			respondError(c, 400, fmt.Sprintf("part %d has not been uploaded", i))
+			return
+		}
+		if part.ETag != "" && part.ETag != etag {
+			respondError(c, 400, fmt.Sprintf("etag mismatch for part %d", i))
+			return
+		}
+	}
+
+	tmpPath, hash, size, err := s.concatParts(upload)
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	defer os.Remove(tmpPath)
+	if size != upload.FileSize {
+		respondError(c, 400, fmt.Sprintf("size mismatch: expected %d bytes, received %d", upload.FileSize, size))
+		return
+	}
+	if upload.Hash != "" && upload.Hash != hash {
+		respondError(c, 400, fmt.Sprintf("hash mismatch: expected %s, received %s", upload.Hash, hash))
+		return
+	}
+
+	rec := fileRecord{Hash: hash, Size: size, ModTime: upload.ModTime}
+	if err := s.commitFile(upload.Username, upload.Repo, upload.FileName, tmpPath, rec); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	os.RemoveAll(s.uploads.uploadDir(upload.UploadID))
+	respond(c, listEntry{Path: upload.FileName, Hash: hash, ModTime: strconv.FormatInt(rec.ModTime, 10), Size: size})
+}
+
+// concatParts 把分片依次写入临时文件，返回临时文件路径、SHA-256 和大小
+func (s *Server) concatParts(upload *chunkUpload) (string, string, int64, error) {
+	tmp, err := os.CreateTemp(tmpRoot(s.opts.DataDir), "complete-*")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	hasher := sha256.New()
+	w := io.MultiWriter(tmp, hasher)
+
+	var size int64
+	for i := 0; i < upload.TotalParts; i++ {
+		n, err := copyFile(w, s.uploads.partPath(upload.UploadID, i))
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", "", 0, fmt.Errorf("failed to assemble part %d: %w", i, err)
+		}
+		size += n
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+	return tmp.Name(), hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+func copyFile(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// respondUploadError 未知的 upload_id 返回 410，与"服务器不支持查询"的 404 区分开
+func respondUploadError(c *app.RequestContext, id string, err error) {
+	if errors.Is(err, errUploadNotFound) {
+		respondError(c, 410, fmt.Sprintf("upload %s not found or expired", id))
+		return
+	}
+	respondError(c, 500, err.Error())
+}
+
+func sortedParts(parts map[int]string) []model.CompletedPart {
+	list := make([]model.CompletedPart, 0, len(parts))
+	for index, etag := range parts {
+		list = append(list, model.CompletedPart{PartIndex: index, ETag: etag})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PartIndex < list[j].PartIndex })
+	return list
+}
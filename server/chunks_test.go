@@ -0,0 +1,291 @@
+package server
+
+import (
+	"encoding/json"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/model"
+)
+
+// initUpload 创建一个分片上传并返回 upload_id
+func (ts *testServer) initUpload(t *testing.T, req initRequest) string {
+	t.Helper()
+	r := ts.postJSON(t, "/file/upload/init", nil, req)
+	if r.status != 200 {
+		t.Fatalf("upload init: %d %s", r.status, r.body)
+	}
+	var data struct {
+		UploadID string `json:"upload_id"`
+	}
+	r.decode(&data)
+	return data.UploadID
+}
+
+// uploadChunk 上传一个分片
+func (ts *testServer) uploadChunk(t *testing.T, id string, index int, content []byte) testResponse {
+	t.Helper()
+	fields := map[string]string{"upload_id": id, "part_index": strconv.Itoa(index)}
+	return ts.postMultipart(t, "/file/upload/chunk", nil, fields, "blob", content)
+}
+
+func TestChunkedUpload(t *testing.T) {
+	parts := [][]byte{[]byte("hello "), []byte("chunked "), []byte("world")}
+	content := []byte("hello chunked world")
+
+	tests := []struct {
+		name     string
+		hash     string
+		size     int64
+		upload   []int // 上传的分片序号
+		complete []model.CompletedPart
+		status   int
+		msg      string
+	}{
+		{
+			name:     "complete",
+			hash:     sha256Hex(content),
+			upload:   []int{2, 0, 1},
+			complete: []model.CompletedPart{{PartIndex: 1}, {PartIndex: 0}, {PartIndex: 2}},
+			status:   200,
+		},
+		{
+			name:     "without hash",
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}, {PartIndex: 2}},
+			status:   200,
+		},
+		{
+			name:     "hash mismatch",
+			hash:     sha256Hex([]byte("something else")),
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}, {PartIndex: 2}},
+			status:   400,
+			msg:      "hash mismatch",
+		},
+		{
+			name:     "size mismatch",
+			size:     int64(len(content)) + 1,
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}, {PartIndex: 2}},
+			status:   400,
+			msg:      "size mismatch",
+		},
+		{
+			name:     "missing part",
+			upload:   []int{0, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}, {PartIndex: 2}},
+			status:   400,
+			msg:      "part 1 has not been uploaded",
+		},
+		{
+			name:     "wrong number of parts",
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}},
+			status:   400,
+			msg:      "expected 3 parts, got 2",
+		},
+		{
+			name:     "duplicate part index",
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1}, {PartIndex: 1}},
+			status:   400,
+			msg:      "part 2 has not been uploaded",
+		},
+		{
+			name:     "etag mismatch",
+			upload:   []int{0, 1, 2},
+			complete: []model.CompletedPart{{PartIndex: 0}, {PartIndex: 1, ETag: sha256Hex([]byte("x"))}, {PartIndex: 2}},
+			status:   400,
+			msg:      "etag mismatch for part 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Options{})
+			size := tt.size
+			if size == 0 {
+				size = int64(len(content))
+			}
+			id := ts.initUpload(t, initRequest{Repo: "demo", FileName: "dir/big.bin", FileSize: size, TotalParts: len(parts), ModTime: 1700000000, Hash: tt.hash})
+
+			for _, index := range tt.upload {
+				r := ts.uploadChunk(t, id, index, parts[index])
+				var resp model.ChunkUploadResponse
+				r.decode(&resp)
+				if r.status != 200 || resp.ETag != sha256Hex(parts[index]) {
+					t.Fatalf("chunk %d: %d %s", index, r.status, r.body)
+				}
+			}
+
+			r := ts.postJSON(t, "/file/upload/complete", nil, model.CompleteUploadRequest{UploadID: id, Parts: tt.complete})
+			if r.status != tt.status || !strings.Contains(r.msg(), tt.msg) {
+				t.Fatalf("complete = %d %q, want %d %q", r.status, r.msg(), tt.status, tt.msg)
+			}
+
+			rec, stored := ts.store.lookupFile(testUser, "demo", "dir/big.bin")
+			_, statErr := os.Stat(ts.uploads.uploadDir(id))
+			if tt.status != 200 {
+				if stored {
+					t.Error("file stored after a failed complete")
+				}
+				if statErr != nil {
+					t.Error("upload removed after a failed complete, the client cannot retry")
+				}
+				return
+			}
+			if !stored || rec.Hash != sha256Hex(content) || rec.Size != int64(len(content)) || rec.ModTime != 1700000000 {
+				t.Errorf("stored record = %+v, %v", rec, stored)
+			}
+			if !os.IsNotExist(statErr) {
+				t.Errorf("upload dir left after complete: %v", statErr)
+			}
+			got := ts.request(t, "GET", "/file/download", neturl.Values{"repo": {"demo"}, "file": {"dir/big.bin"}}, nil, nil)
+			if string(got.body) != string(content) {
+				t.Errorf("downloaded %q, want %q", got.body, content)
+			}
+		})
+	}
+}
+
+func TestUploadChunkBounds(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	id := ts.initUpload(t, initRequest{Repo: "demo", FileName: "a.bin", FileSize: 4, TotalParts: 2})
+
+	tests := []struct {
+		name   string
+		id     string
+		index  string
+		status int
+		msg    string
+	}{
+		{name: "negative index", id: id, index: "-1", status: 400, msg: "part_index -1 out of range [0, 2)"},
+		{name: "index equal to total", id: id, index: "2", status: 400, msg: "part_index 2 out of range [0, 2)"},
+		{name: "invalid index", id: id, index: "one", status: 400, msg: "invalid part_index"},
+		{name: "unknown upload", id: "0123abcd", index: "0", status: 410, msg: "not found or expired"},
+		{name: "upload id outside the upload dir", id: "../" + id, index: "0", status: 410, msg: "not found or expired"},
+		{name: "last index", id: id, index: "1", status: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]string{"upload_id": tt.id, "part_index": tt.index}
+			r := ts.postMultipart(t, "/file/upload/chunk", nil, fields, "blob", []byte("ab"))
+			if r.status != tt.status || !strings.Contains(r.msg(), tt.msg) {
+				t.Errorf("chunk = %d %q, want %d %q", r.status, r.msg(), tt.status, tt.msg)
+			}
+		})
+	}
+
+	for _, req := range []initRequest{
+		{Repo: "demo", FileName: "a.bin", FileSize: 1, TotalParts: 0},
+		{Repo: "demo", FileName: "a.bin", FileSize: 1, TotalParts: maxTotalParts + 1},
+		{Repo: "demo", FileName: "a.bin", FileSize: -1, TotalParts: 1},
+	} {
+		if r := ts.postJSON(t, "/file/upload/init", nil, req); r.status != 400 {
+			t.Errorf("init %+v = %d, want 400", req, r.status)
+		}
+	}
+
+	// 其它用户看不到这个上传
+	other, err := ts.newSession("bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := *ts
+	bob.token = other["token"]
+	if r := bob.request(t, "GET", "/file/upload/status", neturl.Values{"upload_id": {id}}, nil, nil); r.status != 410 {
+		t.Errorf("status of another user's upload = %d, want 410", r.status)
+	}
+}
+
+func TestSweepExpiresByLastActivity(t *testing.T) {
+	ttl := time.Hour
+	now := time.Now()
+	old := now.Add(-2 * ttl)
+	recent := now.Add(-ttl / 2)
+
+	tests := []struct {
+		name      string
+		info      *chunkUpload // nil 表示没有 info.json
+		dirTime   time.Time
+		wantSwept bool
+	}{
+		{name: "recent", info: &chunkUpload{CreatedAt: recent, UpdatedAt: recent}},
+		{name: "old but still receiving chunks", info: &chunkUpload{CreatedAt: old, UpdatedAt: recent}},
+		{name: "abandoned", info: &chunkUpload{CreatedAt: old, UpdatedAt: old}, wantSwept: true},
+		{name: "written before updated_at existed", info: &chunkUpload{CreatedAt: old}, wantSwept: true},
+		{name: "recent, written before updated_at existed", info: &chunkUpload{CreatedAt: recent}},
+		{name: "no info.json", dirTime: old, wantSwept: true},
+		{name: "no info.json, recent", dirTime: recent},
+	}
+
+	u := newUploadManager(t.TempDir(), ttl)
+	ids := map[string]string{}
+	for i, tt := range tests {
+		id := strconv.Itoa(i)
+		ids[tt.name] = id
+		if err := os.MkdirAll(u.uploadDir(id), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if tt.info != nil {
+			tt.info.UploadID = id
+			if err := u.save(tt.info); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.Chtimes(u.uploadDir(id), tt.dirTime, tt.dirTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u.sweep(now)
+	for _, tt := range tests {
+		_, err := os.Stat(u.uploadDir(ids[tt.name]))
+		if swept := os.IsNotExist(err); swept != tt.wantSwept {
+			t.Errorf("%s: swept = %v, want %v", tt.name, swept, tt.wantSwept)
+		}
+	}
+}
+
+func TestUploadChunkRecordsActivity(t *testing.T) {
+	ts := newTestServer(t, Options{UploadTTL: time.Hour})
+	id := ts.initUpload(t, initRequest{Repo: "demo", FileName: "a.bin", FileSize: 4, TotalParts: 2})
+
+	// 模拟一个一天前开始、仍在进行的上传
+	infoPath := filepath.Join(ts.uploads.uploadDir(id), "info.json")
+	upload, err := ts.uploads.load(id, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.CreatedAt = time.Now().Add(-24 * time.Hour).UTC()
+	upload.UpdatedAt = upload.CreatedAt
+	if err := ts.uploads.save(upload); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if r := ts.uploadChunk(t, id, 0, []byte("ab")); r.status != 200 {
+		t.Fatalf("chunk: %d %s", r.status, r.body)
+	}
+	data, err := os.ReadFile(infoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved chunkUpload
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.UpdatedAt.Before(before.Add(-time.Second)) {
+		t.Errorf("updated_at = %v after a chunk write, want about %v", saved.UpdatedAt, before)
+	}
+
+	ts.uploads.sweep(time.Now())
+	if r := ts.uploadChunk(t, id, 1, []byte("cd")); r.status != 200 {
+		t.Fatalf("chunk after sweep: %d %s, the active upload was removed", r.status, r.body)
+	}
+}
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/litongjava/hfile/config"
+)
+
+// listEntry 是 /file/list 返回的一项，mod_time 为 Unix 秒的字符串形式
+type listEntry struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	ModTime string `json:"mod_time"`
+	Size    int64  `json:"size"`
+}
+
+// uploadedFile 是从 multipart 请求体中读出的文件，内容已写入临时文件
+type uploadedFile struct {
+	TmpPath  string
+	FileName string
+	Size     int64
+	Hash     string
+	Fields   map[string]string
+}
+
+func (s *Server) handleRepoList(ctx context.Context, c *app.RequestContext) {
+	respond(c, s.store.listRepos(currentUser(c)))
+}
+
+func (s *Server) handleRepoRename(ctx context.Context, c *app.RequestContext) {
+	username := currentUser(c)
+	repo, ok := repoParam(c, "repo")
+	if !ok {
+		return
+	}
+	newName, ok := repoParam(c, "new_name")
+	if !ok {
+		return
+	}
+	if newName == repo {
+		respond(c, map[string]string{"repo": newName})
+		return
+	}
+
+	status := 0
+	err := s.store.update(func(m *metadata) error {
+		repos := m.Repos[username]
+		if _, ok := repos[repo]; !ok {
+			status = 404
+			return fmt.Errorf("repository %s not found", repo)
+		}
+		if _, ok := repos[newName]; ok {
+			status = 409
+			return fmt.Errorf("repository %s already exists", newName)
+		}
+		oldDir, newDir := s.repoDir(username, repo), s.repoDir(username, newName)
+		if err := os.Rename(oldDir, newDir); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rename repository: %w", err)
+		}
+		repos[newName] = repos[repo]
+		delete(repos, repo)
+		return nil
+	})
+	if err != nil {
+		if status == 0 {
+			status = 500
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	respond(c, map[string]string{"repo": newName})
+}
+
+// handleFileList 返回仓库中的文件，仓库不存在时返回空列表
+func (s *Server) handleFileList(ctx context.Context, c *app.RequestContext) {
+	repo, ok := repoParam(c, "repo")
+	if !ok {
+		return
+	}
+	files := s.store.listFiles(currentUser(c), repo)
+	entries := make([]listEntry, 0, len(files))
+	for p, rec := range files {
+		entries = append(entries, listEntry{Path: p, Hash: rec.Hash, ModTime: strconv.FormatInt(rec.ModTime, 10), Size: rec.Size})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	respond(c, entries)
+}
+
+// handleUpload 接收整个文件，文件名为仓库内路径，hash 字段存在时校验内容
+func (s *Server) handleUpload(ctx context.Context, c *app.RequestContext) {
+	repo, ok := repoParam(c, "repo")
+	if !ok {
+		return
+	}
+	upload, err := s.readMultipart(c)
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+	defer os.Remove(upload.TmpPath)
+
+	filePath, err := cleanRemotePath(upload.FileName)
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+	if want := upload.Fields["hash"]; want != "" && !strings.EqualFold(want, upload.Hash) {
+		respondError(c, 400, fmt.Sprintf("hash mismatch: expected %s, received %s", want, upload.Hash))
+		return
+	}
+
+	rec := fileRecord{Hash: upload.Hash, Size: upload.Size, ModTime: parseModTime(upload.Fields["original_mod_time"])}
+	if err := s.commitFile(currentUser(c), repo, filePath, upload.TmpPath, rec); err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, listEntry{Path: filePath, Hash: rec.Hash, ModTime: strconv.FormatInt(rec.ModTime, 10), Size: rec.Size})
+}
+
+// handleDelete 删除文件，文件不存在时同样返回成功
+func (s *Server) handleDelete(ctx context.Context, c *app.RequestContext) {
+	username := currentUser(c)
+	repo, ok := repoParam(c, "repo")
+	if !ok {
+		return
+	}
+	filePath, err := cleanRemotePath(c.Query("file"))
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+
+	err = s.store.update(func(m *metadata) error {
+		files := m.repoFiles(username, repo, false)
+		if _, ok := files[filePath]; !ok {
+			return nil
+		}
+		blob := s.blobPath(username, repo, filePath)
+		if err := os.Remove(blob); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %s: %w", filePath, err)
+		}
+		removeEmptyParents(filepath.Dir(blob), s.repoDir(username, repo))
+		delete(files, filePath)
+		return nil
+	})
+	if err != nil {
+		respondError(c, 500, err.Error())
+		return
+	}
+	respond(c, nil)
+}
+
+// handleDownload 返回文件内容，支持 Range: bytes=N-、bytes=N-M 和 bytes=-N，
+// If-Range 与当前 ETag 或 Last-Modified 不一致时忽略 Range 返回完整内容
+func (s *Server) handleDownload(ctx context.Context, c *app.RequestContext) {
+	username := currentUser(c)
+	repo, ok := repoParam(c, "repo")
+	if !ok {
+		return
+	}
+	filePath, err := cleanRemotePath(c.Query("file"))
+	if err != nil {
+		respondError(c, 400, err.Error())
+		return
+	}
+
+	// 在锁内打开文件，保证内容与元数据属于同一版本
+	var rec fileRecord
+	var file *os.File
+	s.store.view(func(m *metadata) {
+		var found bool
+		if rec, found = m.repoFiles(username, repo, false)[filePath]; !found {
+			err = os.ErrNotExist
+			return
+		}
+		file, err = os.Open(s.blobPath(username, repo, filePath))
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			respondError(c, 404, fmt.Sprintf("file %s not found", filePath))
+			return
+		}
+		respondError(c, 500, err.Error())
+		return
+	}
+
+	etag := `"` + rec.Hash + `"`
+	lastModified := time.Unix(rec.ModTime, 0).UTC().Format(http.TimeFormat)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified)
+	c.Header("X-Content-SHA256", rec.Hash)
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(filePath)}))
+	c.SetContentType("application/octet-stream")
+
+	rangeHeader := string(c.GetHeader("Range"))
+	if ifRange := string(c.GetHeader("If-Range")); ifRange != "" && ifRange != etag && ifRange != lastModified {
+		rangeHeader = ""
+	}
+	if rangeHeader == "" {
+		c.SetBodyStream(file, int(rec.Size))
+		return
+	}
+
+	start, end, ok := parseRange(rangeHeader, rec.Size)
+	if !ok {
+		file.Close()
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", rec.Size))
+		respondError(c, http.StatusRequestedRangeNotSatisfiable, "requested range not satisfiable")
+		return
+	}
+	length := end - start + 1
+	c.Status(http.StatusPartialContent)
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, rec.Size))
+	c.SetBodyStream(readCloser{io.NewSectionReader(file, start, length), file}, int(length))
+}
+
+// readCloser 让 SetBodyStream 读完区间后关闭文件
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readMultipart 流式解析 multipart 请求体，名为 file 的部分写入临时文件并计算 SHA-256，
+// 其余部分作为普通字段，字段可以出现在文件之前或之后
+func (s *Server) readMultipart(c *app.RequestContext) (*uploadedFile, error) {
+	_, params, err := mime.ParseMediaType(string(c.Request.Header.ContentType()))
+	if err != nil || params["boundary"] == "" {
+		return nil, errors.New("expected multipart/form-data request")
+	}
+
+	upload := &uploadedFile{Fields: map[string]string{}}
+	reader := multipart.NewReader(c.Request.BodyStream(), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			upload.cleanup()
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 64*1024))
+			part.Close()
+			if err != nil {
+				upload.cleanup()
+				return nil, fmt.Errorf("failed to read field %s: %w", part.FormName(), err)
+			}
+			upload.Fields[part.FormName()] = string(value)
+			continue
+		}
+		if upload.TmpPath != "" {
+			part.Close()
+			upload.cleanup()
+			return nil, errors.New("request contains more than one file")
+		}
+
+		upload.FileName = partFileName(part)
+		err = s.saveTemp(part, upload)
+		part.Close()
+		if err != nil {
+			upload.cleanup()
+			return nil, err
+		}
+	}
+
+	if upload.TmpPath == "" {
+		return nil, errors.New("missing file part")
+	}
+	return upload, nil
+}
+
+// saveTemp 把 r 写入 tmp 目录下的临时文件，同时记录大小和 SHA-256
+func (s *Server) saveTemp(r io.Reader, upload *uploadedFile) error {
+	tmp, err := os.CreateTemp(tmpRoot(s.opts.DataDir), "upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	upload.TmpPath = tmp.Name()
+	// CreateTemp 创建的文件权限为 0600，仓库中的文件按普通文件保存
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to receive file: %w", err)
+	}
+	upload.Size = size
+	upload.Hash = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// partFileName 返回 multipart 中未经处理的文件名。part.FileName 只保留最后一级，
+// 而客户端用文件名传递仓库内的完整路径
+func partFileName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+func (u *uploadedFile) cleanup() {
+	if u.TmpPath != "" {
+		os.Remove(u.TmpPath)
+	}
+}
+
+// commitFile 把临时文件移动到仓库中并记录元数据，同一路径的旧内容被替换
+func (s *Server) commitFile(username, repo, filePath, tmpPath string, rec fileRecord) error {
+	modTime := time.Unix(rec.ModTime, 0)
+	if err := os.Chtimes(tmpPath, modTime, modTime); err != nil {
+		return fmt.Errorf("failed to set mod time: %w", err)
+	}
+
+	return s.store.update(func(m *metadata) error {
+		blob := s.blobPath(username, repo, filePath)
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+		}
+		if err := os.Rename(tmpPath, blob); err != nil {
+			return fmt.Errorf("failed to store %s: %w", filePath, err)
+		}
+		m.repoFiles(username, repo, true)[filePath] = rec
+		return nil
+	})
+}
+
+func (s *Server) repoDir(username, repo string) string {
+	return filepath.Join(blobRoot(s.opts.DataDir), username, repo)
+}
+
+func (s *Server) blobPath(username, repo, filePath string) string {
+	return filepath.Join(s.repoDir(username, repo), filepath.FromSlash(filePath))
+}
+
+// repoParam 读取并校验仓库名参数，失败时已写入 400 响应
+func repoParam(c *app.RequestContext, name string) (string, bool) {
+	repo := c.Query(name)
+	return repo, checkRepo(c, repo)
+}
+
+// checkRepo 校验仓库名，失败时写入 400 响应
+func checkRepo(c *app.RequestContext, repo string) bool {
+	if err := config.ValidateRepoName(repo); err != nil {
+		respondError(c, 400, err.Error())
+		return false
+	}
+	return true
+}
+
+// cleanRemotePath 校验仓库内的相对路径，拒绝绝对路径和 .. 等可能越出仓库目录的路径
+func cleanRemotePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("file path is required")
+	}
+	if strings.ContainsAny(p, "\\\x00") || strings.HasPrefix(p, "/") || path.Clean(p) != p {
+		return "", fmt.Errorf("invalid file path %q", p)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." || segment == "." {
+			return "", fmt.Errorf("invalid file path %q", p)
+		}
+	}
+	return p, nil
+}
+
+// parseModTime 解析 Unix 秒，缺失或无效时使用当前时间
+func parseModTime(value string) int64 {
+	if t, err := strconv.ParseInt(value, 10, 64); err == nil && t > 0 {
+		return t
+	}
+	return time.Now().Unix()
+}
+
+// parseRange 解析单个字节区间，返回闭区间 [start, end]
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// removeEmptyParents 删除 dir 及其上层的空目录，直到 stop 为止（不含 stop）
+func removeEmptyParents(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
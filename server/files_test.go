@@ -0,0 +1,198 @@
+package server
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		size       int64
+		start, end int64
+		ok         bool
+	}{
+		{header: "bytes=0-", size: 10, start: 0, end: 9, ok: true},
+		{header: "bytes=4-", size: 10, start: 4, end: 9, ok: true},
+		{header: "bytes=2-5", size: 10, start: 2, end: 5, ok: true},
+		{header: "bytes=2-100", size: 10, start: 2, end: 9, ok: true},
+		{header: "bytes=-3", size: 10, start: 7, end: 9, ok: true},
+		{header: "bytes=-30", size: 10, start: 0, end: 9, ok: true},
+		{header: "bytes=9-9", size: 10, start: 9, end: 9, ok: true},
+		{header: "bytes=10-", size: 10},
+		{header: "bytes=5-2", size: 10},
+		{header: "bytes=-0", size: 10},
+		{header: "bytes=-3", size: 0},
+		{header: "bytes=0-", size: 0},
+		{header: "bytes=-1-2", size: 10},
+		{header: "bytes=0-1,4-5", size: 10},
+		{header: "bytes=a-", size: 10},
+		{header: "bytes=3", size: 10},
+		{header: "items=0-1", size: 10},
+		{header: "", size: 10},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseRange(tt.header, tt.size)
+		if ok != tt.ok || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v, want %d, %d, %v", tt.header, tt.size, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
+
+func TestCleanRemotePath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{path: "a.txt", ok: true},
+		{path: "dir/sub/a.txt", ok: true},
+		{path: ".hidden", ok: true},
+		{path: "a..b", ok: true},
+		{path: ""},
+		{path: "/etc/passwd"},
+		{path: "../a.txt"},
+		{path: "dir/../../a.txt"},
+		{path: "dir/.."},
+		{path: "./a.txt"},
+		{path: "dir/./a.txt"},
+		{path: "dir//a.txt"},
+		{path: "dir/"},
+		{path: `dir\a.txt`},
+		{path: `..\a.txt`},
+		{path: "a\x00.txt"},
+	}
+	for _, tt := range tests {
+		got, err := cleanRemotePath(tt.path)
+		if tt.ok && (err != nil || got != tt.path) {
+			t.Errorf("cleanRemotePath(%q) = %q, %v, want it accepted", tt.path, got, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("cleanRemotePath(%q) = %q, want an error", tt.path, got)
+		}
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	content := []byte("0123456789")
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()
+	ts.upload(t, "demo", "dir/a.txt", content, modTime)
+
+	etag := `"` + sha256Hex(content) + `"`
+	lastModified := time.Unix(modTime, 0).UTC().Format(http.TimeFormat)
+	query := neturl.Values{"repo": {"demo"}, "file": {"dir/a.txt"}}
+
+	tests := []struct {
+		name         string
+		header       http.Header
+		status       int
+		body         string
+		contentRange string
+	}{
+		{name: "full", status: 200, body: "0123456789"},
+		{name: "open range", header: http.Header{"Range": {"bytes=4-"}}, status: 206, body: "456789", contentRange: "bytes 4-9/10"},
+		{name: "closed range", header: http.Header{"Range": {"bytes=2-5"}}, status: 206, body: "2345", contentRange: "bytes 2-5/10"},
+		{name: "suffix range", header: http.Header{"Range": {"bytes=-3"}}, status: 206, body: "789", contentRange: "bytes 7-9/10"},
+		{
+			name:   "If-Range matches ETag",
+			header: http.Header{"Range": {"bytes=4-"}, "If-Range": {etag}},
+			status: 206, body: "456789", contentRange: "bytes 4-9/10",
+		},
+		{
+			name:   "If-Range matches Last-Modified",
+			header: http.Header{"Range": {"bytes=8-"}, "If-Range": {lastModified}},
+			status: 206, body: "89", contentRange: "bytes 8-9/10",
+		},
+		{
+			name:   "stale If-Range returns the whole file",
+			header: http.Header{"Range": {"bytes=4-"}, "If-Range": {`"0000"`}},
+			status: 200, body: "0123456789",
+		},
+		{name: "unsatisfiable range", header: http.Header{"Range": {"bytes=10-"}}, status: 416, contentRange: "bytes */10"},
+		{name: "multiple ranges", header: http.Header{"Range": {"bytes=0-1,4-5"}}, status: 416, contentRange: "bytes */10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ts.request(t, "GET", "/file/download", query, nil, tt.header)
+			if r.status != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", r.status, tt.status, r.body)
+			}
+			if tt.status != 416 && string(r.body) != tt.body {
+				t.Errorf("body = %q, want %q", r.body, tt.body)
+			}
+			if got := r.header.Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+			}
+			if tt.status != 416 {
+				if got := r.header.Get("ETag"); got != etag {
+					t.Errorf("ETag = %q, want %q", got, etag)
+				}
+				if got := r.header.Get("Last-Modified"); got != lastModified {
+					t.Errorf("Last-Modified = %q, want %q", got, lastModified)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadHashCheck(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	content := []byte("hello")
+	query := neturl.Values{"repo": {"demo"}}
+
+	r := ts.postMultipart(t, "/file/upload", query, map[string]string{"hash": sha256Hex([]byte("other"))}, "a.txt", content)
+	if r.status != 400 || !strings.Contains(r.msg(), "hash mismatch") {
+		t.Fatalf("upload with wrong hash = %d %q, want 400 hash mismatch", r.status, r.msg())
+	}
+	if _, ok := ts.store.lookupFile(testUser, "demo", "a.txt"); ok {
+		t.Fatal("file stored despite hash mismatch")
+	}
+
+	r = ts.postMultipart(t, "/file/upload", query, map[string]string{"hash": strings.ToUpper(sha256Hex(content))}, "a.txt", content)
+	if r.status != 200 {
+		t.Fatalf("upload with matching hash = %d %s", r.status, r.body)
+	}
+	rec, ok := ts.store.lookupFile(testUser, "demo", "a.txt")
+	if !ok || rec.Hash != sha256Hex(content) || rec.Size != int64(len(content)) {
+		t.Fatalf("stored record = %+v, %v", rec, ok)
+	}
+}
+
+func TestPathEscaping(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	ts.upload(t, "demo", "a.txt", []byte("hello"), time.Now().Unix())
+
+	for _, p := range []string{"../../meta.json", "/etc/passwd", "dir/../../x", `..\meta.json`, ""} {
+		t.Run(p, func(t *testing.T) {
+			r := ts.postMultipart(t, "/file/upload", neturl.Values{"repo": {"demo"}}, nil, p, []byte("x"))
+			if r.status != 400 {
+				t.Errorf("upload %q = %d, want 400", p, r.status)
+			}
+			query := neturl.Values{"repo": {"demo"}, "file": {p}}
+			if r := ts.request(t, "GET", "/file/download", query, nil, nil); r.status != 400 {
+				t.Errorf("download %q = %d, want 400", p, r.status)
+			}
+			if r := ts.request(t, "POST", "/file/delete", query, nil, nil); r.status != 400 {
+				t.Errorf("delete %q = %d, want 400", p, r.status)
+			}
+			r = ts.postJSON(t, "/file/upload/init", nil, initRequest{Repo: "demo", FileName: p, FileSize: 1, TotalParts: 1})
+			if r.status != 400 {
+				t.Errorf("upload init %q = %d, want 400", p, r.status)
+			}
+		})
+	}
+
+	for _, repo := range []string{"../alice", "a/b", ""} {
+		query := neturl.Values{"repo": {repo}, "file": {"a.txt"}}
+		if r := ts.request(t, "GET", "/file/download", query, nil, nil); r.status != 400 {
+			t.Errorf("download from repo %q = %d, want 400", repo, r.status)
+		}
+	}
+
+	if r := ts.request(t, "GET", "/file/download", neturl.Values{"repo": {"demo"}, "file": {"a.txt"}}, nil, nil); string(r.body) != "hello" {
+		t.Errorf("a.txt = %q after rejected requests, want hello", r.body)
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/litongjava/hfile/model"
+)
+
+// fieldError 是注册等表单校验失败时 data 中的一项
+type fieldError struct {
+	Field    string   `json:"field"`
+	Messages []string `json:"messages"`
+}
+
+// respond 返回成功的 APIResponse
+func respond(c *app.RequestContext, data interface{}) {
+	c.JSON(200, model.APIResponse{Code: 200, Ok: true, Data: data})
+}
+
+// respondError 返回失败的 APIResponse，HTTP 状态码与 code 一致
+func respondError(c *app.RequestContext, status int, msg string) {
+	c.AbortWithStatusJSON(status, model.APIResponse{Code: status, Ok: false, Msg: &msg})
+}
+
+// respondFieldErrors 返回表单校验错误
+func respondFieldErrors(c *app.RequestContext, errs []fieldError) {
+	msg := "validation failed"
+	c.AbortWithStatusJSON(400, model.APIResponse{Code: 400, Ok: false, Msg: &msg, Data: errs})
+}
@@ -0,0 +1,161 @@
+// Package server 是 hfile 的参考服务器实现，基于 Hertz 提供客户端使用的全部接口，
+// 文件内容保存在本地目录中，用户、会话和文件元数据保存在同一目录下的 meta.json 中。
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	hzserver "github.com/cloudwego/hertz/pkg/app/server"
+)
+
+const (
+	DefaultAddr       = ":8080"
+	DefaultDataDir    = "hfile-data"
+	DefaultTokenTTL   = 24 * time.Hour
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+	DefaultUploadTTL  = 24 * time.Hour
+)
+
+// Options 是服务器的启动参数，零值字段使用默认值
+type Options struct {
+	Addr       string
+	DataDir    string
+	TokenTTL   time.Duration
+	RefreshTTL time.Duration
+	// UploadTTL 是未完成的分片上传在最后一次收到分片后保留的时长，超过后分片被清理，客户端需要重新上传
+	UploadTTL time.Duration
+}
+
+// Server 是一个 hfile 服务器实例
+type Server struct {
+	opts    Options
+	store   *store
+	uploads *uploadManager
+	hertz   *hzserver.Hertz
+}
+
+// New 创建服务器并准备数据目录，调用 Spin 后开始监听
+func New(opts Options) (*Server, error) {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.DataDir == "" {
+		opts.DataDir = DefaultDataDir
+	}
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+	if opts.RefreshTTL <= 0 {
+		opts.RefreshTTL = DefaultRefreshTTL
+	}
+	if opts.UploadTTL <= 0 {
+		opts.UploadTTL = DefaultUploadTTL
+	}
+
+	dataDir, err := filepath.Abs(opts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data dir: %w", err)
+	}
+	opts.DataDir = dataDir
+	for _, dir := range []string{blobRoot(dataDir), tmpRoot(dataDir), uploadRoot(dataDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data dir: %w", err)
+		}
+	}
+
+	// Hertz 在监听失败时直接 panic，这里先检查地址是否可用，以便返回普通错误
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", opts.Addr, err)
+	}
+	ln.Close()
+
+	st, err := openStore(filepath.Join(dataDir, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		opts:    opts,
+		store:   st,
+		uploads: newUploadManager(uploadRoot(dataDir), opts.UploadTTL),
+	}
+	// 清理上次运行留下的过期分片上传
+	s.uploads.sweep(time.Now())
+
+	// 上传使用流式请求体，multipart 由处理函数自己解析，内存占用与文件大小无关
+	s.hertz = hzserver.New(
+		hzserver.WithHostPorts(opts.Addr),
+		hzserver.WithStreamBody(true),
+		hzserver.WithDisablePreParseMultipartForm(true),
+		hzserver.WithDisablePrintRoute(true),
+		hzserver.WithExitWaitTime(5*time.Second),
+	)
+	s.routes()
+	return s, nil
+}
+
+// Options 返回补全默认值后的启动参数
+func (s *Server) Options() Options {
+	return s.opts
+}
+
+// Spin 启动服务器，收到 SIGINT/SIGTERM 后优雅退出
+func (s *Server) Spin() {
+	s.hertz.Spin()
+}
+
+// Shutdown 停止服务器
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.hertz.Shutdown(ctx)
+}
+
+func (s *Server) routes() {
+	h := s.hertz
+
+	h.POST("/api/v1/register", s.handleRegister)
+	h.POST("/api/v1/login", s.handleLogin)
+	h.POST("/api/v1/refresh", s.handleRefresh)
+	h.POST("/api/v1/logout", s.handleLogout)
+
+	auth := h.Group("", s.requireAuth)
+	auth.GET("/api/v1/user/profile", s.handleProfile)
+
+	auth.GET("/repo/list", s.handleRepoList)
+	auth.POST("/repo/rename", s.handleRepoRename)
+
+	auth.GET("/file/list", s.handleFileList)
+	auth.POST("/file/upload", s.handleUpload)
+	auth.POST("/file/delete", s.handleDelete)
+	auth.GET("/file/download", s.handleDownload)
+
+	auth.POST("/file/upload/init", s.handleUploadInit)
+	auth.POST("/file/upload/chunk", s.handleUploadChunk)
+	auth.GET("/file/upload/status", s.handleUploadStatus)
+	auth.POST("/file/upload/complete", s.handleUploadComplete)
+
+	h.NoRoute(func(ctx context.Context, c *app.RequestContext) {
+		respondError(c, 404, "not found")
+	})
+}
+
+// blobRoot 保存文件内容：blobs/<user>/<repo>/<path>
+func blobRoot(dataDir string) string {
+	return filepath.Join(dataDir, "blobs")
+}
+
+// tmpRoot 保存上传中的临时文件，与 blobs 在同一文件系统上以便原子重命名
+func tmpRoot(dataDir string) string {
+	return filepath.Join(dataDir, "tmp")
+}
+
+// uploadRoot 保存分片上传：uploads/<upload_id>/
+func uploadRoot(dataDir string) string {
+	return filepath.Join(dataDir, "uploads")
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/litongjava/hfile/model"
+)
+
+// testUser 是测试服务器中预先登录的用户
+const testUser = "alice"
+
+// testServer 是在随机端口上运行的服务器，token 属于 testUser
+type testServer struct {
+	*Server
+	url   string
+	token string
+}
+
+// newTestServer 在临时数据目录上启动服务器，测试结束时关闭
+func newTestServer(t *testing.T, opts Options) *testServer {
+	t.Helper()
+	hlog.SetLevel(hlog.LevelError)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Addr = ln.Addr().String()
+	ln.Close()
+	if opts.DataDir == "" {
+		opts.DataDir = t.TempDir()
+	}
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	go s.hertz.Run()
+	t.Cleanup(func() { s.Shutdown(t.Context()) })
+
+	// 等待开始监听
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		conn, err := net.Dial("tcp", opts.Addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 直接创建会话，避免每个测试都计算 PBKDF2
+	tokens, err := s.newSession(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{Server: s, url: "http://" + opts.Addr, token: tokens["token"]}
+}
+
+// testResponse 是一次请求的状态码、响应头和解析后的 APIResponse
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	api    model.APIResponse
+}
+
+// msg 返回失败响应中的错误信息
+func (r testResponse) msg() string {
+	if r.api.Msg == nil {
+		return ""
+	}
+	return *r.api.Msg
+}
+
+// decode 把响应的 data 解析到 v
+func (r testResponse) decode(v interface{}) {
+	data, _ := json.Marshal(r.api.Data)
+	json.Unmarshal(data, v)
+}
+
+// request 以 testUser 的身份发送请求，header 中的 Authorization 会覆盖默认的 token
+func (ts *testServer) request(t *testing.T, method, path string, query neturl.Values, body io.Reader, header http.Header) testResponse {
+	t.Helper()
+	target := ts.url + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(t.Context(), method, target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	r := testResponse{status: resp.StatusCode, header: resp.Header, body: data}
+	json.Unmarshal(data, &r.api)
+	return r
+}
+
+// postJSON 发送 JSON 请求体
+func (ts *testServer) postJSON(t *testing.T, path string, query neturl.Values, v interface{}) testResponse {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.request(t, "POST", path, query, bytes.NewReader(data), http.Header{"Content-Type": {"application/json"}})
+}
+
+// postMultipart 发送 multipart 请求体，fileName 为文件部分的文件名
+func (ts *testServer) postMultipart(t *testing.T, path string, query neturl.Values, fields map[string]string, fileName string, content []byte) testResponse {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for key, value := range fields {
+		w.WriteField(key, value)
+	}
+	part, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	w.Close()
+	return ts.request(t, "POST", path, query, &buf, http.Header{"Content-Type": {w.FormDataContentType()}})
+}
+
+// upload 用 /file/upload 上传一个文件，失败时终止测试
+func (ts *testServer) upload(t *testing.T, repo, filePath string, content []byte, modTime int64) {
+	t.Helper()
+	fields := map[string]string{"original_mod_time": strconv.FormatInt(modTime, 10)}
+	if r := ts.postMultipart(t, "/file/upload", neturl.Values{"repo": {repo}}, fields, filePath, content); r.status != 200 {
+		t.Fatalf("upload %s: %d %s", filePath, r.status, r.body)
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// user 是一个注册用户，密码保存为 PBKDF2-SHA256 哈希
+type user struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Salt         string    `json:"salt"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// session 是一对登录令牌，access token 过期后可用 refresh token 换取新的一对
+type session struct {
+	Username       string    `json:"username"`
+	RefreshToken   string    `json:"refresh_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	RefreshExpires time.Time `json:"refresh_expires"`
+}
+
+// fileRecord 是仓库中一个文件的元数据，内容保存在 blobs 目录
+type fileRecord struct {
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// metadata 是 meta.json 的内容
+type metadata struct {
+	Users    map[string]*user   `json:"users"`
+	Sessions map[string]session `json:"sessions"`
+	// Refresh 由 refresh token 指向对应的 access token
+	Refresh map[string]string `json:"refresh"`
+	// Repos 按 用户 -> 仓库 -> 路径 保存文件元数据
+	Repos map[string]map[string]map[string]fileRecord `json:"repos"`
+}
+
+// store 是加锁的元数据存储，每次修改后整体写回 meta.json
+type store struct {
+	mu   sync.Mutex
+	path string
+	meta metadata
+}
+
+func openStore(path string) (*store, error) {
+	s := &store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.meta); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata %s: %w", path, err)
+		}
+	}
+	if s.meta.Users == nil {
+		s.meta.Users = map[string]*user{}
+	}
+	if s.meta.Sessions == nil {
+		s.meta.Sessions = map[string]session{}
+	}
+	if s.meta.Refresh == nil {
+		s.meta.Refresh = map[string]string{}
+	}
+	if s.meta.Repos == nil {
+		s.meta.Repos = map[string]map[string]map[string]fileRecord{}
+	}
+	return s, nil
+}
+
+// update 在锁内修改元数据并写回，fn 返回错误时不写回
+func (s *store) update(fn func(m *metadata) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := fn(&s.meta); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// view 在锁内读取元数据
+func (s *store) view(fn func(m *metadata)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.meta)
+}
+
+// save 先写临时文件再重命名，避免中途退出留下损坏的 meta.json
+func (s *store) save() error {
+	data, err := json.MarshalIndent(s.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".meta-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+// repoFiles 返回用户仓库的文件表，create 为 true 时不存在则创建
+func (m *metadata) repoFiles(username, repo string, create bool) map[string]fileRecord {
+	repos := m.Repos[username]
+	if repos == nil {
+		if !create {
+			return nil
+		}
+		repos = map[string]map[string]fileRecord{}
+		m.Repos[username] = repos
+	}
+	files := repos[repo]
+	if files == nil && create {
+		files = map[string]fileRecord{}
+		repos[repo] = files
+	}
+	return files
+}
+
+// lookupFile 返回仓库中一个文件的元数据
+func (s *store) lookupFile(username, repo, path string) (fileRecord, bool) {
+	var rec fileRecord
+	var ok bool
+	s.view(func(m *metadata) {
+		rec, ok = m.repoFiles(username, repo, false)[path]
+	})
+	return rec, ok
+}
+
+// listFiles 返回仓库中文件元数据的副本
+func (s *store) listFiles(username, repo string) map[string]fileRecord {
+	files := map[string]fileRecord{}
+	s.view(func(m *metadata) {
+		for path, rec := range m.repoFiles(username, repo, false) {
+			files[path] = rec
+		}
+	})
+	return files
+}
+
+// listRepos 返回用户的仓库名，按名称排序
+func (s *store) listRepos(username string) []string {
+	repos := []string{}
+	s.view(func(m *metadata) {
+		for name := range m.Repos[username] {
+			repos = append(repos, name)
+		}
+	})
+	sort.Strings(repos)
+	return repos
+}
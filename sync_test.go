@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/litongjava/hfile/client/clienttest"
+	"github.com/litongjava/hfile/config"
+	"github.com/litongjava/hfile/model"
+)
+
+// runHfile 以命令行参数运行 hfile，返回退出码和标准输出
+func runHfile(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	code := newApp().Run(args)
+
+	w.Close()
+	os.Stdout = stdout
+	return code, <-output
+}
+
+// newTestRepo 启动假服务器，在临时目录中创建指向它的仓库 demo。
+// 用户主目录和 HFILE_* 环境变量都指向测试专用的值，重试等待缩短到毫秒级。
+func newTestRepo(t *testing.T) (*clienttest.Server, string) {
+	t.Helper()
+	srv := clienttest.NewServer()
+	t.Cleanup(srv.Close)
+
+	isolateConfig(t)
+	t.Setenv(config.EnvToken, srv.Token())
+	t.Setenv(config.EnvRetryBaseDelay, "1ms")
+	t.Setenv(config.EnvRetryMaxDelay, "5ms")
+
+	dir := t.TempDir()
+	if code, out := runHfile(t, "init-local", srv.URL, "--repo", "demo", "--repo-dir", dir); code != 0 {
+		t.Fatalf("init-local exited with %d:\n%s", code, out)
+	}
+	return srv, dir
+}
+
+// writeFile 写入仓库中的文件，并设置一个与内容相关的修改时间，保证哈希缓存不会误用旧值
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	localPath := filepath.Join(root, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(localPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(1700000000+int64(len(content))*1000, 0)
+	if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, root, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// transfer 以 ndjson 输出运行 push/pull，返回退出码和最后一行的汇总
+func transfer(t *testing.T, dir string, args ...string) (int, model.TransferReport) {
+	t.Helper()
+	code, out := runHfile(t, append(args, "--repo-dir", dir, "--output", "ndjson")...)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var report model.TransferReport
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &report); err != nil || report.Event != "summary" {
+		t.Fatalf("%s: no summary in output (exit %d):\n%s", args[0], code, out)
+	}
+	return code, report
+}
+
+// status 以 json 输出运行 status
+func status(t *testing.T, dir string) (int, model.StatusReport, string) {
+	t.Helper()
+	code, out := runHfile(t, "status", "--repo-dir", dir, "--json")
+	var report model.StatusReport
+	json.Unmarshal([]byte(out), &report)
+	return code, report, out
+}
+
+// errorReport 解析命令失败时的 json 输出
+func errorReport(t *testing.T, out string) string {
+	t.Helper()
+	var report model.ErrorReport
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&report); err != nil || report.Error == "" {
+		t.Fatalf("no error report in output:\n%s", out)
+	}
+	return report.Error
+}
+
+func TestPushPullStatus(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "hello")
+	writeFile(t, dir, "docs/b.txt", "world!")
+
+	if code, report, _ := status(t, dir); code != 0 || len(report.Entries) != 2 {
+		t.Fatalf("status before push: exit %d, entries %+v", code, report.Entries)
+	}
+
+	code, report := transfer(t, dir, "push")
+	if code != 0 || report.Succeeded != 2 {
+		t.Fatalf("push: exit %d, report %+v", code, report)
+	}
+	if f, ok := srv.File("demo", "docs/b.txt"); !ok || string(f.Content) != "world!" {
+		t.Fatalf("docs/b.txt on server = %q, %v", f.Content, ok)
+	}
+	if code, report, _ := status(t, dir); code != 0 || len(report.Entries) != 0 {
+		t.Fatalf("status after push: exit %d, entries %+v", code, report.Entries)
+	}
+
+	// 远程修改、新增和删除都应在 pull 后反映到本地
+	srv.PutFile("demo", "a.txt", []byte("hello again"), time.Now().Unix())
+	srv.PutFile("demo", "c.txt", []byte("new"), time.Now().Unix())
+	srv.RemoveFile("demo", "docs/b.txt")
+
+	code, report = transfer(t, dir, "pull")
+	if code != 0 || report.Succeeded != 3 {
+		t.Fatalf("pull: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "hello again" {
+		t.Errorf("a.txt = %q after pull", got)
+	}
+	if got := readFile(t, dir, "c.txt"); got != "new" {
+		t.Errorf("c.txt = %q after pull", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("docs/b.txt still exists after remote delete: %v", err)
+	}
+	if code, report, _ := status(t, dir); code != 0 || len(report.Entries) != 0 {
+		t.Fatalf("status after pull: exit %d, entries %+v", code, report.Entries)
+	}
+}
+
+func TestStatusFromSubdirectory(t *testing.T) {
+	_, dir := newTestRepo(t)
+	writeFile(t, dir, "docs/a.txt", "hello")
+
+	code, out := runHfile(t, "status", "--repo-dir", filepath.Join(dir, "docs"), "--output", "ndjson")
+	if code != 0 {
+		t.Fatalf("status exited with %d:\n%s", code, out)
+	}
+	var entry model.StatusEntry
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("status output: %v\n%s", err, out)
+	}
+	if entry.SchemaVersion != model.OutputSchemaVersion || entry.Path != "docs/a.txt" || entry.Action != "upload" {
+		t.Errorf("status entry = %+v", entry)
+	}
+	if entry.LocalSize == nil || *entry.LocalSize != 5 || entry.RemoteSize != nil {
+		t.Errorf("status sizes = %v, %v", entry.LocalSize, entry.RemoteSize)
+	}
+}
+
+func TestTransfersRetryServerErrors(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "hello")
+
+	srv.Inject(clienttest.Fault{Path: "/file/upload", Kind: clienttest.FaultStatus, Status: 500, Times: 2})
+	code, report := transfer(t, dir, "push")
+	if code != 0 || report.Succeeded != 1 || report.Results[0].Retries != 2 {
+		t.Fatalf("push: exit %d, report %+v", code, report)
+	}
+
+	srv.PutFile("demo", "b.txt", []byte("remote"), time.Now().Unix())
+	srv.Inject(clienttest.Fault{Path: "/file/download", Kind: clienttest.FaultStatus, Status: 503, Times: 1})
+	code, report = transfer(t, dir, "pull")
+	if code != 0 || report.Succeeded != 1 {
+		t.Fatalf("pull: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "b.txt"); got != "remote" {
+		t.Errorf("b.txt = %q", got)
+	}
+
+	// 状态码错误一直出现时用完重试次数，失败的文件在下一次 push 时继续上传
+	writeFile(t, dir, "c.txt", "later")
+	srv.Inject(clienttest.Fault{Path: "/file/upload", Kind: clienttest.FaultStatus, Status: 500})
+	code, report = transfer(t, dir, "push")
+	if code != 1 || report.Failed != 1 {
+		t.Fatalf("push with persistent 500: exit %d, report %+v", code, report)
+	}
+	if _, ok := srv.File("demo", "c.txt"); ok {
+		t.Fatal("c.txt uploaded despite persistent 500")
+	}
+
+	srv.ClearFaults()
+	code, report = transfer(t, dir, "push")
+	if code != 0 || report.Succeeded != 1 || report.Results[0].Path != "c.txt" {
+		t.Fatalf("push after recovery: exit %d, report %+v", code, report)
+	}
+}
+
+func TestTransfersRetryDroppedConnections(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "hello")
+
+	srv.Inject(clienttest.Fault{Path: "/file/list", Kind: clienttest.FaultDropConnection, Times: 1})
+	srv.Inject(clienttest.Fault{Path: "/file/upload", Kind: clienttest.FaultDropConnection, Times: 1})
+	code, report := transfer(t, dir, "push")
+	if code != 0 || report.Succeeded != 1 {
+		t.Fatalf("push: exit %d, report %+v", code, report)
+	}
+	if f, ok := srv.File("demo", "a.txt"); !ok || string(f.Content) != "hello" {
+		t.Fatalf("a.txt on server = %q, %v", f.Content, ok)
+	}
+
+	srv.PutFile("demo", "b.txt", []byte("remote"), time.Now().Unix())
+	srv.Inject(clienttest.Fault{Path: "/file/download", Kind: clienttest.FaultDropConnection, Times: 1})
+	code, report = transfer(t, dir, "pull")
+	if code != 0 || report.Succeeded != 1 {
+		t.Fatalf("pull: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "b.txt"); got != "remote" {
+		t.Errorf("b.txt = %q", got)
+	}
+
+	srv.Inject(clienttest.Fault{Path: "/file/list", Kind: clienttest.FaultDropConnection, Times: 1})
+	if code, report, out := status(t, dir); code != 0 || len(report.Entries) != 0 {
+		t.Fatalf("status: exit %d:\n%s", code, out)
+	}
+}
+
+func TestPullTruncatedBody(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	content := strings.Repeat("0123456789", 1000)
+	srv.PutFile("demo", "big.txt", []byte(content), time.Now().Unix())
+
+	// 响应中断后从已下载的部分继续
+	srv.Inject(clienttest.Fault{Path: "/file/download", Kind: clienttest.FaultTruncateBody, Times: 1})
+	code, report := transfer(t, dir, "pull")
+	if code != 0 || report.Succeeded != 1 {
+		t.Fatalf("pull: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "big.txt"); got != content {
+		t.Fatalf("big.txt has %d bytes, want %d", len(got), len(content))
+	}
+
+	// 每次都中断时不能在目标位置留下不完整的文件，下一次 pull 完成下载
+	srv.PutFile("demo", "big.txt", []byte(content+"more"), time.Now().Unix())
+	srv.Inject(clienttest.Fault{Path: "/file/download", Kind: clienttest.FaultTruncateBody})
+	code, report = transfer(t, dir, "pull")
+	if code != 1 || report.Failed != 1 {
+		t.Fatalf("pull with persistent truncation: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "big.txt"); got != content {
+		t.Fatalf("big.txt was modified by a failed download (%d bytes)", len(got))
+	}
+
+	srv.ClearFaults()
+	code, report = transfer(t, dir, "pull")
+	if code != 0 || report.Succeeded != 1 {
+		t.Fatalf("pull after recovery: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "big.txt"); got != content+"more" {
+		t.Fatalf("big.txt has %d bytes, want %d", len(got), len(content)+4)
+	}
+}
+
+func TestMalformedModTime(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "local")
+	srv.PutFile("demo", "b.txt", []byte("remote"), time.Now().Unix())
+	srv.Inject(clienttest.Fault{Path: "/file/list", Kind: clienttest.FaultMalformedModTime})
+
+	for _, command := range []string{"status", "push", "pull"} {
+		code, out := runHfile(t, command, "--repo-dir", dir, "--json")
+		if code != 1 {
+			t.Fatalf("%s exited with %d, want 1:\n%s", command, code, out)
+		}
+		if msg := errorReport(t, out); !strings.Contains(msg, "invalid mod_time") {
+			t.Errorf("%s error = %q", command, msg)
+		}
+	}
+	if _, ok := srv.File("demo", "a.txt"); ok {
+		t.Error("push uploaded a.txt although the file list could not be read")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("pull downloaded b.txt although the file list could not be read")
+	}
+
+	srv.ClearFaults()
+	if code, report := transfer(t, dir, "pull"); code != 0 || report.Succeeded != 1 {
+		t.Fatalf("pull after recovery: exit %d, report %+v", code, report)
+	}
+}
+
+func TestPullRejectsUnsafeRemotePaths(t *testing.T) {
+	for _, path := range []string{"../escape.txt", "/etc/escape.txt", ".hfile/config.toml", "a/../../escape.txt"} {
+		t.Run(path, func(t *testing.T) {
+			srv, dir := newTestRepo(t)
+			srv.PutFile("demo", path, []byte("bad"), time.Now().Unix())
+			configBefore := readFile(t, dir, ".hfile/config.toml")
+
+			code, out := runHfile(t, "pull", "--repo-dir", dir, "--json")
+			if code != 1 {
+				t.Fatalf("pull exited with %d, want 1:\n%s", code, out)
+			}
+			if msg := errorReport(t, out); !strings.Contains(msg, "unsafe remote path") {
+				t.Errorf("pull error = %q", msg)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); !os.IsNotExist(err) {
+				t.Error("pull wrote outside the repository")
+			}
+			if got := readFile(t, dir, ".hfile/config.toml"); got != configBefore {
+				t.Error("pull overwrote .hfile/config.toml")
+			}
+		})
+	}
+}
+
+func TestPullConflictCopyOnce(t *testing.T) {
+	srv, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "base")
+	if code, report := transfer(t, dir, "push"); code != 0 {
+		t.Fatalf("push: exit %d, report %+v", code, report)
+	}
+
+	writeFile(t, dir, "a.txt", "local change")
+	srv.PutFile("demo", "a.txt", []byte("remote change"), time.Now().Unix())
+
+	for i := 0; i < 2; i++ {
+		if code, report := transfer(t, dir, "pull"); code != 1 || len(report.Conflicts) != 1 {
+			t.Fatalf("pull %d: exit %d, report %+v", i+1, code, report)
+		}
+	}
+	// 第二次 pull 时冲突副本已经存在，不应再下载
+	if n := srv.CountRequests("GET /file/download"); n != 1 {
+		t.Errorf("remote version downloaded %d times, want once", n)
+	}
+	copies, _ := filepath.Glob(filepath.Join(dir, "a.txt.conflict-*"))
+	if len(copies) != 1 {
+		t.Fatalf("conflict copies = %v, want exactly one", copies)
+	}
+	if got := readFile(t, dir, filepath.Base(copies[0])); got != "remote change" {
+		t.Errorf("conflict copy = %q", got)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "local change" {
+		t.Errorf("a.txt = %q, local version must be kept", got)
+	}
+}
+
+func TestPullFromAnotherServerKeepsLocalFiles(t *testing.T) {
+	_, dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "hello")
+	if code, report := transfer(t, dir, "push"); code != 0 {
+		t.Fatalf("push: exit %d, report %+v", code, report)
+	}
+
+	// 另一个服务器上的同名仓库是空的，上次同步的状态不适用，本地文件不能被当作远程已删除
+	other := clienttest.NewServer()
+	defer other.Close()
+	t.Setenv(config.EnvToken, other.Token())
+	if code, report := transfer(t, dir, "pull", "--server", other.URL); code != 0 || report.Succeeded != 0 {
+		t.Fatalf("pull from other server: exit %d, report %+v", code, report)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "hello" {
+		t.Fatalf("a.txt = %q after pulling from another server", got)
+	}
+}
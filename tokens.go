@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/litongjava/hfile/client"
+	"github.com/litongjava/hfile/config"
+)
+
+// savedTokens 是保存在凭证文件中（或来自 HFILE_TOKEN）的 token，实现 client.TokenSource，刷新后写回凭证文件
+type savedTokens struct {
+	serverURL string
+
+	mu      sync.Mutex
+	token   string
+	refresh string
+	savedTo string
+}
+
+// loadSavedTokens 读取 serverURL（或当前 profile）保存的 token，未登录时返回错误
+func loadSavedTokens(serverURL string) (*savedTokens, error) {
+	token, refresh, err := config.LoadToken(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	return &savedTokens{serverURL: serverURL, token: token, refresh: refresh}, nil
+}
+
+// Token 返回最新的 access token
+func (t *savedTokens) Token() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// SavedTo 返回最近一次刷新写入的凭证文件，token 来自环境变量或尚未刷新时为空
+func (t *savedTokens) SavedTo() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.savedTo
+}
+
+// Refresh 用 refresh token 换取新 token。expired 已经被其它请求刷新过时直接返回新 token
+func (t *savedTokens) Refresh(ctx context.Context, c *client.Client, expired string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if expired != "" && expired != t.token {
+		return t.token, nil
+	}
+	if t.refresh == "" {
+		return "", fmt.Errorf("no refresh token saved, please login again")
+	}
+
+	tokens, err := c.Refresh(ctx, t.refresh)
+	if err != nil {
+		return "", err
+	}
+	// 服务器没有轮换 refresh_token 时继续使用原来的
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = t.refresh
+	}
+	t.token, t.refresh = tokens.Token, tokens.RefreshToken
+
+	// token 来自环境变量时只在本进程内使用新 token，不写入凭证文件
+	if config.TokenFromEnv() {
+		return t.token, nil
+	}
+	path, err := config.SaveToken(t.serverURL, t.token, t.refresh)
+	if err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+	t.savedTo = path
+	return t.token, nil
+}
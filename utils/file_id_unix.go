@@ -0,0 +1,16 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 返回文件所在设备号和 inode，用于识别被替换的文件
+func fileID(info os.FileInfo) (uint64, uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino)
+	}
+	return 0, 0
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package utils
+
+import "os"
+
+// fileID 在 Windows 上无法从 FileInfo 取得文件标识，只依赖大小和修改时间
+func fileID(info os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HashCacheFile 本地哈希缓存，位于仓库的 .hfile 目录下
+const HashCacheFile = "index"
+
+const hashCacheVersion = 1
+
+// racyWindow 修改时间离哈希时刻太近的文件可能在同一时间粒度内再次被修改，不写入缓存
+const racyWindow = 2 * time.Second
+
+type hashCacheEntry struct {
+	Dev     uint64 `json:"dev"`
+	Ino     uint64 `json:"ino"`
+	Size    int64  `json:"size"`
+	MtimeNs int64  `json:"mtime_ns"`
+	Hash    string `json:"hash"`
+}
+
+type hashCacheDocument struct {
+	Version  int                       `json:"version"`
+	HashAlgo string                    `json:"hash_algo"`
+	Entries  map[string]hashCacheEntry `json:"entries"`
+}
+
+// HashCache 按 (设备号, inode, 大小, 纳秒修改时间) 缓存文件哈希，只有这些属性变化时才重新计算
+type HashCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]hashCacheEntry
+	seen    map[string]bool
+	dirty   bool
+}
+
+// LoadHashCache 读取仓库的哈希缓存，文件不存在或格式不兼容时返回空缓存
+func LoadHashCache(repoRoot string) *HashCache {
+	cache := &HashCache{
+		path:    filepath.Join(repoRoot, ".hfile", HashCacheFile),
+		entries: make(map[string]hashCacheEntry),
+		seen:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+
+	var doc hashCacheDocument
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Version != hashCacheVersion || doc.HashAlgo != HashAlgo {
+		cache.dirty = true
+		return cache
+	}
+	if doc.Entries != nil {
+		cache.entries = doc.Entries
+	}
+	return cache
+}
+
+// Hash 返回文件的哈希，stat 信息与缓存一致时直接使用缓存；rehash 为 true 时总是重新计算
+func (c *HashCache) Hash(relPath, absPath string, info os.FileInfo, rehash bool) (string, error) {
+	dev, ino := fileID(info)
+	mtime := info.ModTime()
+	current := hashCacheEntry{Dev: dev, Ino: ino, Size: info.Size(), MtimeNs: mtime.UnixNano()}
+
+	c.mu.Lock()
+	c.seen[relPath] = true
+	cached, ok := c.entries[relPath]
+	c.mu.Unlock()
+
+	if !rehash && ok && cached.Dev == current.Dev && cached.Ino == current.Ino &&
+		cached.Size == current.Size && cached.MtimeNs == current.MtimeNs {
+		return cached.Hash, nil
+	}
+
+	hash, err := HashFile(absPath)
+	if err != nil {
+		return "", err
+	}
+	current.Hash = hash
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(mtime) < racyWindow {
+		if ok {
+			delete(c.entries, relPath)
+			c.dirty = true
+		}
+		return hash, nil
+	}
+	c.entries[relPath] = current
+	c.dirty = true
+	return hash, nil
+}
+
+// Save 写回缓存并删除本次扫描中没有出现的文件，缓存未变化时不写盘
+func (c *HashCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path := range c.entries {
+		if !c.seen[path] {
+			delete(c.entries, path)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(hashCacheDocument{
+		Version:  hashCacheVersion,
+		HashAlgo: HashAlgo,
+		Entries:  c.entries,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode hash cache: %w", err)
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save hash cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
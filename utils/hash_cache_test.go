@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashCacheInvalidation(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, path string)
+		rehash bool
+		cached bool // true 表示应直接返回缓存中的哈希
+	}{
+		{name: "unchanged", cached: true},
+		{name: "rehash requested", rehash: true},
+		{
+			name:   "size changed",
+			modify: func(t *testing.T, path string) { writeTestFile(t, path, "hello world", old) },
+		},
+		{
+			name:   "mtime changed",
+			modify: func(t *testing.T, path string) { writeTestFile(t, path, "hello", old.Add(time.Second)) },
+		},
+		{
+			// stat 信息不变时不会读取文件内容，这正是 racyWindow 要避免的情况
+			name:   "content changed with the same size and mtime",
+			modify: func(t *testing.T, path string) { writeTestFile(t, path, "HELLO", old) },
+			cached: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			path := filepath.Join(root, "a.txt")
+			writeTestFile(t, path, "hello", old)
+
+			cache := LoadHashCache(root)
+			if _, err := cache.Hash("a.txt", path, statTestFile(t, path), false); err != nil {
+				t.Fatal(err)
+			}
+			entry, ok := cache.entries["a.txt"]
+			if !ok {
+				t.Fatal("hash of an old file not cached")
+			}
+			entry.Hash = "cached"
+			cache.entries["a.txt"] = entry
+
+			if tt.modify != nil {
+				tt.modify(t, path)
+			}
+			got, err := cache.Hash("a.txt", path, statTestFile(t, path), tt.rehash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "cached"
+			if !tt.cached {
+				want = hashTestFile(t, path)
+			}
+			if got != want {
+				t.Errorf("Hash = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestHashCacheRacyWindow(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	// 刚刚修改过的文件，同一时间粒度内还可能再次被修改
+	now := time.Now()
+	writeTestFile(t, path, "hello", now)
+
+	cache := LoadHashCache(root)
+	if _, err := cache.Hash("a.txt", path, statTestFile(t, path), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries["a.txt"]; ok {
+		t.Fatal("hash of a file modified within racyWindow was cached")
+	}
+
+	// 大小和修改时间都不变的修改也会被发现
+	writeTestFile(t, path, "HELLO", now)
+	got, err := cache.Hash("a.txt", path, statTestFile(t, path), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hashTestFile(t, path); got != want {
+		t.Errorf("Hash = %q, want %q after an in-place edit", got, want)
+	}
+
+	// 已缓存的文件进入 racyWindow 后移除旧的缓存项
+	old := now.Add(-time.Hour)
+	writeTestFile(t, path, "hello", old)
+	if _, err := cache.Hash("a.txt", path, statTestFile(t, path), false); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path, "hello!", now)
+	if _, err := cache.Hash("a.txt", path, statTestFile(t, path), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries["a.txt"]; ok {
+		t.Error("stale cache entry kept for a file modified within racyWindow")
+	}
+}
+
+func TestHashCacheSaveAndLoad(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".hfile"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		writeTestFile(t, filepath.Join(root, name), name, old)
+	}
+
+	cache := LoadHashCache(root)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(root, name)
+		if _, err := cache.Hash(name, path, statTestFile(t, path), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 本次扫描中没有出现的文件从缓存中删除
+	cache = LoadHashCache(root)
+	if len(cache.entries) != 2 {
+		t.Fatalf("loaded %d entries, want 2", len(cache.entries))
+	}
+	path := filepath.Join(root, "a.txt")
+	if _, err := cache.Hash("a.txt", path, statTestFile(t, path), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache = LoadHashCache(root)
+	if _, ok := cache.entries["b.txt"]; ok || len(cache.entries) != 1 {
+		t.Errorf("entries after save = %v, want only a.txt", cache.entries)
+	}
+
+	// 格式不兼容的缓存文件被忽略
+	if err := os.WriteFile(filepath.Join(root, ".hfile", HashCacheFile), []byte(`{"version":0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cache = LoadHashCache(root); len(cache.entries) != 0 {
+		t.Errorf("loaded %d entries from an incompatible cache, want 0", len(cache.entries))
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func statTestFile(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func hashTestFile(t *testing.T, path string) string {
+	t.Helper()
+	hash, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
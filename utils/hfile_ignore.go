@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName 忽略规则文件名，语法与 .gitignore 相同，可以出现在任意子目录中
+const IgnoreFileName = ".hfileignore"
+
+// IgnoreRule 是 .hfileignore 中的一条规则
+type IgnoreRule struct {
+	Source  string // 规则所在文件，相对仓库根目录
+	Line    int
+	Pattern string // 原始文本
+
+	base     string // 规则文件所在目录，相对仓库根目录，根目录为空
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+// IgnoreMatcher 按 gitignore 的语义匹配路径：后出现的规则优先，子目录中的规则晚于父目录加载
+type IgnoreMatcher struct {
+	rules []IgnoreRule
+}
+
+// LoadIgnoreMatcher 读取仓库中所有未被忽略目录下的 .hfileignore
+func LoadIgnoreMatcher(repoRoot string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	err := walkRepo(repoRoot, m, func(string, fs.DirEntry) error { return nil })
+	return m, err
+}
+
+// walkRepo 遍历仓库中的文件，跳过 .hfile 目录和被忽略的路径，进入目录时加载该目录的 .hfileignore
+func walkRepo(repoRoot string, m *IgnoreMatcher, fn func(relPath string, entry fs.DirEntry) error) error {
+	return filepath.WalkDir(repoRoot, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, _ := filepath.Rel(repoRoot, p)
+		relPath = filepath.ToSlash(relPath)
+
+		if entry.IsDir() {
+			if relPath == "." {
+				return m.addFile(repoRoot, "")
+			}
+			if relPath == ".hfile" {
+				return filepath.SkipDir
+			}
+			if m.IsIgnored(relPath, true) {
+				return filepath.SkipDir
+			}
+			return m.addFile(repoRoot, relPath)
+		}
+
+		if path.Base(relPath) == IgnoreFileName || strings.HasPrefix(relPath, ".hfile") {
+			return nil
+		}
+		if m.IsIgnored(relPath, false) {
+			return nil
+		}
+		return fn(relPath, entry)
+	})
+}
+
+// addFile 加载 dir 目录下的 .hfileignore，dir 为相对仓库根目录的路径
+func (m *IgnoreMatcher) addFile(repoRoot, dir string) error {
+	source := path.Join(dir, IgnoreFileName)
+	file, err := os.Open(filepath.Join(repoRoot, filepath.FromSlash(source)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", source, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if rule, ok := parseIgnoreRule(scanner.Text(), dir); ok {
+			rule.Source = source
+			rule.Line = lineNo
+			m.rules = append(m.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	return nil
+}
+
+func parseIgnoreRule(line, base string) (IgnoreRule, bool) {
+	rule := IgnoreRule{Pattern: line, base: base}
+
+	// 去掉未转义的行尾空格
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	// 含有 / 的模式相对规则文件所在目录，否则匹配任意层级的文件名
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// Match 返回最后一条匹配 relPath 的规则以及该路径是否被忽略。
+// 父目录被忽略时其中的文件同样被忽略，且不能被否定规则重新包含。
+func (m *IgnoreMatcher) Match(relPath string, isDir bool) (*IgnoreRule, bool) {
+	relPath = path.Clean(filepath.ToSlash(relPath))
+
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule, ignored := m.matchOne(strings.Join(parts[:i], "/"), true); ignored {
+			return rule, true
+		}
+	}
+	return m.matchOne(relPath, isDir)
+}
+
+// IsIgnored 判断路径是否被忽略
+func (m *IgnoreMatcher) IsIgnored(relPath string, isDir bool) bool {
+	_, ignored := m.Match(relPath, isDir)
+	return ignored
+}
+
+func (m *IgnoreMatcher) matchOne(relPath string, isDir bool) (*IgnoreRule, bool) {
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		rule := &m.rules[i]
+		if rule.matches(relPath, isDir) {
+			return rule, !rule.negate
+		}
+	}
+	return nil, false
+}
+
+func (r *IgnoreRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = strings.TrimPrefix(relPath, r.base+"/")
+	}
+
+	parts := strings.Split(relPath, "/")
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(r.segments, parts)
+}
+
+// matchSegments 逐段匹配，** 匹配零个或多个目录，位于末尾时至少匹配一段
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+// Describe 以 check-ignore 的格式描述规则来源
+func (r *IgnoreRule) Describe() string {
+	return fmt.Sprintf("%s:%d:%s", r.Source, r.Line, r.Pattern)
+}
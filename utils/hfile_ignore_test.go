@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line     string
+		ok       bool
+		negate   bool
+		dirOnly  bool
+		anchored bool
+		segments []string
+	}{
+		{line: "", ok: false},
+		{line: "   ", ok: false},
+		{line: "# comment", ok: false},
+		{line: "/", ok: false},
+		{line: "!", ok: false},
+		{line: "*.log", ok: true, segments: []string{"*.log"}},
+		{line: "*.log   ", ok: true, segments: []string{"*.log"}},
+		{line: `a\ `, ok: true, segments: []string{`a\ `}},
+		{line: "!keep.log", ok: true, negate: true, segments: []string{"keep.log"}},
+		{line: `\!bang`, ok: true, segments: []string{"!bang"}},
+		{line: `\#notes`, ok: true, segments: []string{"#notes"}},
+		{line: "build/", ok: true, dirOnly: true, segments: []string{"build"}},
+		{line: "/root.txt", ok: true, anchored: true, segments: []string{"root.txt"}},
+		{line: "doc/*.md", ok: true, anchored: true, segments: []string{"doc", "*.md"}},
+		{line: "**/build/", ok: true, dirOnly: true, anchored: true, segments: []string{"**", "build"}},
+		{line: "!/a/**/z", ok: true, negate: true, anchored: true, segments: []string{"a", "**", "z"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			rule, ok := parseIgnoreRule(tt.line, "")
+			if ok != tt.ok {
+				t.Fatalf("parseIgnoreRule(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if rule.Pattern != tt.line {
+				t.Errorf("Pattern = %q, want %q", rule.Pattern, tt.line)
+			}
+			if rule.negate != tt.negate || rule.dirOnly != tt.dirOnly || rule.anchored != tt.anchored {
+				t.Errorf("negate, dirOnly, anchored = %v, %v, %v, want %v, %v, %v",
+					rule.negate, rule.dirOnly, rule.anchored, tt.negate, tt.dirOnly, tt.anchored)
+			}
+			if !slices.Equal(rule.segments, tt.segments) {
+				t.Errorf("segments = %q, want %q", rule.segments, tt.segments)
+			}
+		})
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern []string
+		parts   []string
+		want    bool
+	}{
+		{pattern: []string{"a", "b"}, parts: []string{"a", "b"}, want: true},
+		{pattern: []string{"a", "*"}, parts: []string{"a", "b", "c"}, want: false},
+		{pattern: []string{"**", "b"}, parts: []string{"b"}, want: true},
+		{pattern: []string{"**", "b"}, parts: []string{"a", "x", "b"}, want: true},
+		{pattern: []string{"**", "b"}, parts: []string{"a", "b", "c"}, want: false},
+		{pattern: []string{"a", "**", "z"}, parts: []string{"a", "z"}, want: true},
+		{pattern: []string{"a", "**", "z"}, parts: []string{"a", "b", "c", "z"}, want: true},
+		{pattern: []string{"a", "**", "z"}, parts: []string{"b", "z"}, want: false},
+		{pattern: []string{"a", "**"}, parts: []string{"a", "b", "c"}, want: true},
+		// 末尾的 ** 至少匹配一段，不匹配目录本身
+		{pattern: []string{"a", "**"}, parts: []string{"a"}, want: false},
+		{pattern: []string{"**"}, parts: []string{}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchSegments(tt.pattern, tt.parts); got != tt.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	type check struct {
+		path  string
+		isDir bool
+		want  bool
+	}
+	tests := []struct {
+		name   string
+		files  map[string]string // 相对仓库根目录的 .hfileignore -> 内容
+		checks []check
+	}{
+		{
+			name:  "leading **",
+			files: map[string]string{".hfileignore": "**/build\n"},
+			checks: []check{
+				{path: "build", isDir: true, want: true},
+				{path: "a/b/build", isDir: true, want: true},
+				{path: "a/build/out.bin", want: true},
+				{path: "build.txt", want: false},
+			},
+		},
+		{
+			name:  "** in the middle",
+			files: map[string]string{".hfileignore": "a/**/z\n"},
+			checks: []check{
+				{path: "a/z", want: true},
+				{path: "a/b/c/z", want: true},
+				{path: "b/a/z", want: false},
+			},
+		},
+		{
+			name:  "trailing **",
+			files: map[string]string{".hfileignore": "logs/**\n"},
+			checks: []check{
+				{path: "logs", isDir: true, want: false},
+				{path: "logs/x.txt", want: true},
+				{path: "logs/2024/x.txt", want: true},
+				{path: "a/logs/x.txt", want: false},
+			},
+		},
+		{
+			name:  "negation re-includes a file",
+			files: map[string]string{".hfileignore": "*.log\n!keep.log\n"},
+			checks: []check{
+				{path: "a.log", want: true},
+				{path: "keep.log", want: false},
+				{path: "sub/keep.log", want: false},
+			},
+		},
+		{
+			name:  "later rule wins",
+			files: map[string]string{".hfileignore": "!keep.log\n*.log\n"},
+			checks: []check{
+				{path: "keep.log", want: true},
+			},
+		},
+		{
+			name:  "negation can not re-include a file in an ignored directory",
+			files: map[string]string{".hfileignore": "tmp/\n!tmp/keep.txt\n"},
+			checks: []check{
+				{path: "tmp/keep.txt", want: true},
+			},
+		},
+		{
+			name:  "trailing slash matches directories only",
+			files: map[string]string{".hfileignore": "cache/\n"},
+			checks: []check{
+				{path: "cache", isDir: true, want: true},
+				{path: "cache", want: false},
+				{path: "a/cache", isDir: true, want: true},
+				{path: "cache/x", want: true},
+			},
+		},
+		{
+			name:  "anchored and unanchored patterns",
+			files: map[string]string{".hfileignore": "/root.txt\nany.txt\ndoc/*.md\n"},
+			checks: []check{
+				{path: "root.txt", want: true},
+				{path: "sub/root.txt", want: false},
+				{path: "any.txt", want: true},
+				{path: "sub/deep/any.txt", want: true},
+				{path: "doc/a.md", want: true},
+				{path: "x/doc/a.md", want: false},
+				{path: "doc/sub/a.md", want: false},
+			},
+		},
+		{
+			name:  "escaped # and !",
+			files: map[string]string{".hfileignore": "# comment\n\\#notes\n\\!bang\n"},
+			checks: []check{
+				{path: "#notes", want: true},
+				{path: "!bang", want: true},
+				{path: "# comment", want: false},
+				{path: "bang", want: false},
+			},
+		},
+		{
+			name: "nested .hfileignore files",
+			files: map[string]string{
+				".hfileignore":     "*.log\n",
+				"sub/.hfileignore": "!keep.log\n/local.txt\n",
+			},
+			checks: []check{
+				{path: "keep.log", want: true},
+				{path: "sub/keep.log", want: false},
+				{path: "sub/deep/keep.log", want: false},
+				{path: "other/keep.log", want: true},
+				{path: "sub/local.txt", want: true},
+				{path: "sub/deep/local.txt", want: false},
+				{path: "local.txt", want: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestIgnoreMatcher(t, tt.files)
+			for _, c := range tt.checks {
+				if got := m.IsIgnored(c.path, c.isDir); got != c.want {
+					t.Errorf("IsIgnored(%q, dir=%v) = %v, want %v", c.path, c.isDir, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIgnoreMatchReportsRule(t *testing.T) {
+	m := newTestIgnoreMatcher(t, map[string]string{
+		".hfileignore":     "*.log\ntmp/\n",
+		"sub/.hfileignore": "# local rules\n!keep.log\n",
+	})
+	tests := []struct {
+		path  string
+		isDir bool
+		want  string // 为空表示没有规则匹配
+	}{
+		{path: "a.log", want: ".hfileignore:1:*.log"},
+		{path: "sub/keep.log", want: "sub/.hfileignore:2:!keep.log"},
+		{path: "tmp/a/b.txt", want: ".hfileignore:2:tmp/"},
+		{path: "a.txt"},
+	}
+	for _, tt := range tests {
+		rule, _ := m.Match(tt.path, tt.isDir)
+		got := ""
+		if rule != nil {
+			got = rule.Describe()
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) rule = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// newTestIgnoreMatcher 在临时仓库中写入 files 并加载其中的 .hfileignore
+func newTestIgnoreMatcher(t *testing.T, files map[string]string) *IgnoreMatcher {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := LoadIgnoreMatcher(root)
+	if err != nil {
+		t.Fatalf("LoadIgnoreMatcher: %v", err)
+	}
+	return m
+}
@@ -4,14 +4,19 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/litongjava/hfile/model"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
-func GetRepoName(startDir string) (string, error) {
+// HashAlgo 标识 ScanLocalFiles 生成的哈希算法，写入同步状态以便算法变更时丢弃旧基准
+const HashAlgo = "sha256"
+
+// GetRepoRoot 从 startDir 向上查找包含 .hfile 的目录
+func GetRepoRoot(startDir string) (string, error) {
 	dir, err := filepath.Abs(startDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path for %s: %w", startDir, err)
@@ -19,7 +24,7 @@ func GetRepoName(startDir string) (string, error) {
 
 	for {
 		if _, err := os.Stat(filepath.Join(dir, ".hfile")); err == nil {
-			return filepath.Base(dir), nil
+			return dir, nil
 		}
 
 		parent := filepath.Dir(dir)
@@ -32,108 +37,66 @@ func GetRepoName(startDir string) (string, error) {
 	return "", fmt.Errorf("not a hfile repository (or any of the parent directories): .hfile not found")
 }
 
-func ScanLocalFiles(repoDir string) (map[string]model.FileMeta, error) {
+// ScanLocalFiles 扫描仓库中的文件，跳过 .hfile 目录和 .hfileignore 中忽略的路径。
+// 文件哈希优先取自 .hfile/index 缓存，rehash 为 true 时忽略缓存全部重新计算。
+func ScanLocalFiles(repoDir string, rehash bool) (map[string]model.FileMeta, error) {
 	result := make(map[string]model.FileMeta)
+	cache := LoadHashCache(repoDir)
 
-	err := filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+	err := walkRepo(repoDir, &IgnoreMatcher{}, func(relPath string, entry fs.DirEntry) error {
+		info, err := entry.Info()
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
-		}
-
-		relPath, _ := filepath.Rel(repoDir, path)
-		// Skip the ignore file
-		if relPath == ".hfileignore" {
-			return nil
-		}
-		if strings.HasPrefix(relPath, ".hfile") {
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
-		standardizedRelPath := filepath.ToSlash(relPath)
-
-		hash, err := calculateQuickHash(path)
+		hash, err := cache.Hash(relPath, filepath.Join(repoDir, filepath.FromSlash(relPath)), info, rehash)
 		if err != nil {
 			return err
 		}
 
-		result[standardizedRelPath] = model.FileMeta{
-			Path:    standardizedRelPath,
+		result[relPath] = model.FileMeta{
+			Path:    relPath,
 			Hash:    hash,
 			ModTime: info.ModTime().Unix(),
+			Size:    info.Size(),
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.Save(); err != nil {
+		hlog.Warnf("Failed to save hash cache: %v", err)
+	}
+	return result, nil
+}
 
-	return result, err
+// FilterIgnored 去掉被忽略的文件，用于过滤远程文件列表
+func FilterIgnored(files map[string]model.FileMeta, matcher *IgnoreMatcher) map[string]model.FileMeta {
+	result := make(map[string]model.FileMeta, len(files))
+	for path, meta := range files {
+		if !matcher.IsIgnored(path, false) {
+			result[path] = meta
+		}
+	}
+	return result
 }
 
-func calculateQuickHash(filePath string) (string, error) {
-	fileInfo, err := os.Stat(filePath)
+// HashFile 流式计算文件内容的 SHA-256，只与文件内容有关
+func HashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
 
-	fileSize := fileInfo.Size()
-	modTime := fileInfo.ModTime().Unix()
-
-	// 创建 SHA256 hasher
 	hasher := sha256.New()
-
-	// 更新文件大小信息
-	hasher.Write([]byte(fmt.Sprintf("%d", fileSize)))
-
-	// 更新文件修改时间信息
-	hasher.Write([]byte(fmt.Sprintf("%d", modTime)))
-
-	// 如果文件较小，计算完整哈希
-	if fileSize < 1024*1024 { // 1MB以下计算完整哈希
-		file, err := os.Open(filePath)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-
-		_, err = io.Copy(hasher, file)
-		if err != nil {
-			return "", err
-		}
-	} else {
-		// 大文件只取头部和尾部数据
-		file, err := os.Open(filePath)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-
-		// 读取头部
-		headSize := int64(4096)
-		if fileSize < headSize {
-			headSize = fileSize
-		}
-		head := make([]byte, headSize)
-		_, err = file.Read(head)
-		if err != nil && err != io.EOF {
-			return "", err
-		}
-		hasher.Write(head)
-
-		// 读取尾部
-		if fileSize > 8192 {
-			_, err = file.Seek(fileSize-4096, 0)
-			if err != nil {
-				return "", err
-			}
-			tail := make([]byte, 4096)
-			_, err = file.Read(tail)
-			if err != nil && err != io.EOF {
-				return "", err
-			}
-			hasher.Write(tail)
-		}
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
 	}
-
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
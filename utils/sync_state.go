@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/litongjava/hfile/model"
+)
+
+// SyncStateFile 保存上一次成功同步的状态，位于仓库的 .hfile 目录下
+const SyncStateFile = "state.json"
+
+// 版本 2 起记录同步的服务器和远程仓库，版本 1 的状态不知道同步对象，按首次同步处理
+const syncStateVersion = 2
+
+type syncStateDocument struct {
+	Version  int               `json:"version"`
+	HashAlgo string            `json:"hash_algo"`
+	Server   string            `json:"server"`
+	Repo     string            `json:"repo"`
+	Entries  []model.SyncEntry `json:"entries"`
+}
+
+// LoadSyncState 读取仓库与 server 上远程仓库 repo 的同步状态。
+// 文件不存在、哈希算法不一致或上次同步的是另一个服务器或仓库时返回空状态。
+func LoadSyncState(repoRoot, server, repo string) (map[string]model.SyncEntry, error) {
+	result := make(map[string]model.SyncEntry)
+
+	data, err := os.ReadFile(filepath.Join(repoRoot, ".hfile", SyncStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	var doc syncStateDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state: %w", err)
+	}
+
+	// 哈希算法变化后旧的哈希无法比较，只能当作首次同步
+	if doc.Version != syncStateVersion || doc.HashAlgo != HashAlgo {
+		return result, nil
+	}
+	// 换了服务器或仓库后，对方缺少的文件并不是被删除了，不能沿用旧状态
+	if doc.Server != normalizeServer(server) || doc.Repo != repo {
+		return result, nil
+	}
+
+	for _, entry := range doc.Entries {
+		result[entry.Path] = entry
+	}
+	return result, nil
+}
+
+// SaveSyncState 写入与 server 上远程仓库 repo 的同步状态，先写临时文件再重命名，避免中断时留下半个文件
+func SaveSyncState(repoRoot, server, repo string, state map[string]model.SyncEntry) error {
+	doc := syncStateDocument{
+		Version:  syncStateVersion,
+		HashAlgo: HashAlgo,
+		Server:   normalizeServer(server),
+		Repo:     repo,
+		Entries:  make([]model.SyncEntry, 0, len(state)),
+	}
+	for _, path := range SortedKeys(state) {
+		doc.Entries = append(doc.Entries, state[path])
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+
+	statePath := filepath.Join(repoRoot, ".hfile", SyncStateFile)
+	tmpPath := statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	if err := os.Rename(tmpPath, statePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+// normalizeServer 去掉服务器地址末尾的 /，同一服务器的不同写法视为相同
+func normalizeServer(server string) string {
+	return strings.TrimRight(server, "/")
+}
+
+// ResetSyncState 删除同步状态，下次同步当作首次同步处理
+func ResetSyncState(repoRoot string) error {
+	err := os.Remove(filepath.Join(repoRoot, ".hfile", SyncStateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset sync state: %w", err)
+	}
+	return nil
+}
+
+// SortedKeys 返回按路径排序的 key，保证输出稳定
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}